@@ -0,0 +1,131 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	FormatJson     = "json"
+	FormatCommon   = "common"
+	FormatCombined = "combined"
+
+	clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+var Formats = []string{FormatJson, FormatCommon, FormatCombined}
+
+// Entry describes a single served request.
+type Entry struct {
+	Time          time.Time     `json:"time"`
+	ClientIP      string        `json:"client_ip"`
+	User          string        `json:"user,omitempty"`
+	Method        string        `json:"method"`
+	Uri           string        `json:"uri"`
+	Route         string        `json:"route,omitempty"`
+	Protocol      string        `json:"protocol"`
+	Status        int           `json:"status"`
+	RequestBytes  int64         `json:"request_bytes"`
+	ResponseBytes int64         `json:"response_bytes"`
+	Latency       time.Duration `json:"-"`
+	LatencyMs     float64       `json:"latency_ms"`
+	Referer       string        `json:"referer,omitempty"`
+	UserAgent     string        `json:"user_agent,omitempty"`
+	RequestID     string        `json:"request_id,omitempty"`
+}
+
+// Logger writes one line per Entry in json or in the Common or Combined Log Format of Apache httpd.
+// The Log Formats carry only their standard fields, so existing parsers keep working.
+type Logger struct {
+	format string
+	w      io.Writer
+
+	lock sync.Mutex
+	buf  []byte
+}
+
+func New(w io.Writer, format string) (*Logger, error) {
+	switch format {
+	case FormatJson, FormatCommon, FormatCombined:
+		return &Logger{format: format, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+}
+
+func (l *Logger) Log(entry Entry) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.format == FormatJson {
+		entry.LatencyMs = float64(entry.Latency.Microseconds()) / 1000
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		l.buf = append(append(l.buf[:0], line...), '\n')
+	} else {
+		l.buf = l.appendClf(l.buf[:0], entry)
+	}
+
+	_, err := l.w.Write(l.buf)
+	return err
+}
+
+// appendClf appends `host ident authuser [date] "request" status bytes` and, for the combined format,
+// `"referer" "user-agent"`.
+func (l *Logger) appendClf(dst []byte, entry Entry) []byte {
+	dst = append(dst, orDash(entry.ClientIP)...)
+	dst = append(dst, " - "...)
+	dst = append(dst, orDash(entry.User)...)
+	dst = append(dst, " ["...)
+	dst = entry.Time.AppendFormat(dst, clfTimeLayout)
+	dst = append(dst, "] \""...)
+	dst = appendEscaped(dst, entry.Method+" "+entry.Uri+" "+entry.Protocol)
+	dst = append(dst, "\" "...)
+	dst = strconv.AppendInt(dst, int64(entry.Status), 10)
+	dst = append(dst, ' ')
+	if entry.ResponseBytes > 0 {
+		dst = strconv.AppendInt(dst, entry.ResponseBytes, 10)
+	} else {
+		dst = append(dst, '-')
+	}
+
+	if l.format == FormatCombined {
+		dst = append(dst, " \""...)
+		dst = appendEscaped(dst, orDash(entry.Referer))
+		dst = append(dst, "\" \""...)
+		dst = appendEscaped(dst, orDash(entry.UserAgent))
+		dst = append(dst, '"')
+	}
+
+	return append(dst, '\n')
+}
+
+// appendEscaped escapes quotes, backslashes and control characters like httpd does, so client supplied
+// values can't break the line format.
+func appendEscaped(dst []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		b := value[i]
+		switch {
+		case b == '"' || b == '\\':
+			dst = append(dst, '\\', b)
+		case b < 0x20 || b == 0x7f:
+			dst = append(dst, fmt.Sprintf(`\x%02x`, b)...)
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return dst
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -1,15 +1,21 @@
 package api
 
 import (
+	"backend/accesslog"
 	"backend/config"
 	"backend/db"
-	"backend/spotifyapi"
+	"backend/discovery"
+	"backend/health"
+	"backend/logging"
+	"backend/metrics"
+	"backend/telemetry"
+	"errors"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 	"net/http"
 )
 
@@ -17,91 +23,293 @@ type Server struct {
 	Logger zap.Logger
 	Port   int
 
-	restApi       *gin.Engine
-	spotifyClient spotifyapi.SpotifyClient
-	db            *gorm.DB
+	restApi   *gin.Engine
+	db        *gorm.DB
+	auth      *Authenticator
+	devMode   bool
+	limits    config.LimitsConfig
+	health    *health.Registry
+	logLevels *logging.Levels
 }
 
-func NewServer(logger *zap.Logger, client spotifyapi.SpotifyClient, config config.ApiServerConfig, db *gorm.DB) *Server {
-	apiServer := gin.Default()
-	apiServer.Use(ZapLogger(logger))
-	apiServer.Use(cors.New(cors.Config{
-		AllowOrigins: []string{"http://localhost:5173"},
-		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{"Origin", "Content-Length", "Content-Type", "Accept"},
-	}))
+// NewServer builds the API. It never talks to Spotify itself, discovery is left to the worker process via NOTIFY.
+func NewServer(logger *zap.Logger, config config.ApiServerConfig, db *gorm.DB, healthRegistry *health.Registry, logLevels *logging.Levels, accessLog *accesslog.Logger) (*Server, error) {
+	corsConfig, err := buildCorsConfig(config.Cors)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := withLimitDefaults(config.Limits)
+
+	apiServer := gin.New()
+	if err = apiServer.SetTrustedProxies(config.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	apiServer.Use(RequestID())
+	apiServer.Use(otelgin.Middleware(telemetry.DefaultServiceName))
+	if accessLog != nil {
+		apiServer.Use(AccessLog(accessLog, logger))
+	}
+	apiServer.Use(RecoverWithProblem(logger))
+	apiServer.Use(PrometheusMetrics())
+	apiServer.Use(cors.New(corsConfig))
+	apiServer.Use(ErrorHandler(logger))
+	if config.SecurityHeaders != nil {
+		apiServer.Use(SecurityHeaders(*config.SecurityHeaders))
+	}
+	apiServer.Use(NewRateLimiter(limits.RequestsPerSecond, limits.Burst).Middleware())
+	apiServer.Use(MaxBodySize(limits.MaxBodyBytes))
 
-	return &Server{
-		Logger:        *logger,
-		Port:          config.Port,
-		restApi:       apiServer,
-		spotifyClient: client,
-		db:            db,
+	server := &Server{
+		Logger:    *logger,
+		Port:      config.Port,
+		restApi:   apiServer,
+		db:        db,
+		auth:      NewAuthenticator(config.Auth),
+		devMode:   config.DevMode,
+		limits:    limits,
+		health:    healthRegistry,
+		logLevels: logLevels,
 	}
+	server.registerRoutes()
+
+	return server, nil
 }
 
 func (s *Server) Run() error {
-	s.restApi.GET("/health", getHealthStatus)
-	s.restApi.POST("/discover", s.handlePostDiscoverArtists)
-	s.restApi.GET("/discover/status", s.handleGetDiscoverStatus)
-	s.restApi.OPTIONS("/*path", func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Status(http.StatusOK)
-	})
-
 	formattedPort := fmt.Sprintf(":%d", s.Port)
 	return s.restApi.Run(formattedPort)
 }
 
+// Handler exposes the routes without starting a listener.
+func (s *Server) Handler() http.Handler {
+	return s.restApi
+}
+
+func (s *Server) registerRoutes() {
+	s.restApi.GET("/health", getHealthStatus)
+	s.restApi.GET("/health/live", getHealthStatus)
+	s.restApi.GET("/health/ready", s.handleGetReadiness)
+	s.restApi.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	v1 := s.restApi.Group("/api/v1")
+	v1.GET("/openapi.json", handleGetOpenApiDocument)
+
+	authenticated := v1.Group("/", s.auth.Authenticate())
+	authenticated.GET("/discover/status", s.auth.RequireScope(ScopeStatsRead), s.handleGetDiscoverStatus)
+	if s.auth.sessionsEnabled() {
+		authenticated.POST("/auth/session", s.handlePostSession)
+	}
+
+	userRoutes := authenticated.Group("/", UserResolver(s.db, &s.Logger, s.devMode))
+	userRoutes.POST("/discover", s.auth.RequireScope(ScopeImportsWrite), s.handlePostDiscoverArtists)
+	userRoutes.GET("/me", s.auth.RequireScope(ScopeStatsRead), s.handleGetMe)
+	userRoutes.GET("/me/imports", s.auth.RequireScope(ScopeStatsRead), s.handleGetMyImports)
+	userRoutes.GET("/me/stats", s.auth.RequireScope(ScopeStatsRead), s.handleGetMyStats)
+
+	// without auth every caller would be an admin, the routes only exist when they can be protected
+	if s.auth == nil {
+		if s.devMode {
+			s.Logger.Warn("authentication is disabled and dev mode is on, admin routes are not served and users are identified by the X-User header alone")
+		} else {
+			s.Logger.Warn("authentication is disabled, admin routes are not served and user routes answer 401")
+		}
+		return
+	}
+
+	adminRoutes := authenticated.Group("/admin", s.auth.RequireScope(ScopeDiscoveryAdmin))
+	adminRoutes.POST("/discover/run", s.handlePostRunDiscovery)
+	adminRoutes.DELETE("/discover/queue", s.handleDeleteDiscoveryQueue)
+	if s.logLevels != nil {
+		adminRoutes.GET("/log-levels", s.handleGetLogLevels)
+		adminRoutes.PUT("/log-levels/:component", s.handlePutLogLevel)
+	}
+}
+
 func getHealthStatus(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+func (s *Server) handleGetReadiness(c *gin.Context) {
+	report := s.health.Check(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status == health.StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, report)
 }
 
 func (s *Server) handlePostDiscoverArtists(c *gin.Context) {
 	var request DiscoveredArtistsRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(bindError(err))
 		return
 	}
 
-	if request.Artists == nil || len(*request.Artists) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "artists field is required"})
+	if request.Artists != nil && len(*request.Artists) > s.limits.MaxArtistsPerRequest {
+		_ = c.Error(newError(
+			http.StatusUnprocessableEntity,
+			CodeTooManyArtists,
+			fmt.Sprintf("at most %d artists are allowed per request, got %d", s.limits.MaxArtistsPerRequest, len(*request.Artists)),
+		))
 		return
 	}
 
-	s.Logger.Info(fmt.Sprintf("found %d artists", len(*request.Artists)))
+	if details := request.Validate(); len(details) > 0 {
+		_ = c.Error(validationError(details))
+		return
+	}
 
-	var dbDiscovery []db.ArtistDiscovery
+	user := currentUser(c)
+	requestId := c.GetString(requestIdContextKey)
+	logger := requestLogger(c, &s.Logger)
+	logger.Info(fmt.Sprintf("found %d artists", len(*request.Artists)), zap.String("user", user.Name))
+
+	tracks := make([]discovery.QueuedTrack, 0, len(*request.Artists))
 	for _, disc := range *request.Artists {
-		dbDiscovery = append(dbDiscovery, db.ArtistDiscovery{
-			ArtistName: disc.ArtistName,
-			TrackUri:   disc.TrackUri,
+		tracks = append(tracks, discovery.QueuedTrack{ArtistName: disc.ArtistName, TrackUri: disc.TrackUri})
+	}
+
+	if _, err := discovery.Enqueue(c.Request.Context(), s.db, user.ID, requestId, tracks); err != nil {
+		_ = c.Error(db.Classify(err))
+		return
+	}
+
+	if err := discovery.Notify(c.Request.Context(), s.db); err != nil {
+		logger.Warn("error notifying discovery worker", zap.Error(err))
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (s *Server) handleGetDiscoverStatus(c *gin.Context) {
+	stats, err := discovery.GetQueueStats(c.Request.Context(), s.db)
+	if err != nil {
+		_ = c.Error(db.Classify(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, StatusReport{
+		RemainingArtistsCount:  stats.RemainingArtistsCount,
+		AlreadyDiscoveredCount: stats.AlreadyDiscoveredCount,
+	})
+}
+
+func (s *Server) handleGetMe(c *gin.Context) {
+	user := currentUser(c)
+	c.JSON(http.StatusOK, UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+func (s *Server) handleGetMyImports(c *gin.Context) {
+	user := currentUser(c)
+
+	var imports []db.Import
+	res := s.db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&imports)
+	if res.Error != nil {
+		_ = c.Error(db.Classify(res.Error))
+		return
+	}
+
+	response := make([]ImportResponse, 0, len(imports))
+	for _, imp := range imports {
+		response = append(response, ImportResponse{
+			ID:         imp.ID,
+			TrackCount: imp.TrackCount,
+			CreatedAt:  imp.CreatedAt,
 		})
 	}
 
-	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbDiscovery)
+	c.JSON(http.StatusOK, response)
+}
 
-	s.db.Exec("NOTIFY discovery")
+func (s *Server) handleGetMyStats(c *gin.Context) {
+	user := currentUser(c)
 
+	stats, err := discovery.GetUserStats(c.Request.Context(), s.db, user.ID)
+	if err != nil {
+		_ = c.Error(db.Classify(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, UserStatsReport{
+		ImportsCount:          stats.ImportsCount,
+		TracksCount:           stats.TracksCount,
+		DiscoveredTracksCount: stats.DiscoveredTracksCount,
+		RemainingTracksCount:  stats.RemainingTracksCount,
+	})
+}
+
+func (s *Server) handlePostSession(c *gin.Context) {
+	principal := currentPrincipal(c)
+	if !principal.ExpiresAt.IsZero() {
+		_ = c.Error(newError(http.StatusForbidden, CodeForbidden, "session tokens can only be issued for api keys"))
+		return
+	}
+
+	token, expiresAt, err := s.auth.IssueSessionToken(principal)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("error issuing session token: %w", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		Scopes:    principal.Scopes,
+	})
+}
+
+func (s *Server) handlePostRunDiscovery(c *gin.Context) {
+	if err := discovery.Notify(c.Request.Context(), s.db); err != nil {
+		_ = c.Error(db.Classify(err))
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+func (s *Server) handleDeleteDiscoveryQueue(c *gin.Context) {
+	res := s.db.Where("1 = 1").Delete(&db.ArtistDiscovery{})
 	if res.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": res.Error.Error()})
+		_ = c.Error(db.Classify(res.Error))
 		return
 	}
 
-	c.Status(http.StatusOK)
+	requestLogger(c, &s.Logger).Info("cleared discovery queue", zap.Int64("removed", res.RowsAffected))
+	c.JSON(http.StatusOK, QueueClearedResponse{Removed: res.RowsAffected})
 }
 
-func (s *Server) handleGetDiscoverStatus(c *gin.Context) {
-	var alreadyDiscoveredCount int64
-	s.db.Model(&db.Artist{}).Count(&alreadyDiscoveredCount)
+func (s *Server) handleGetLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, LogLevelsResponse{Levels: s.logLevels.Levels()})
+}
 
-	var stillToBeDiscoveredCount int64
-	s.db.Model(&db.ArtistDiscovery{}).Count(&stillToBeDiscoveredCount)
+func (s *Server) handlePutLogLevel(c *gin.Context) {
+	var request LogLevelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		_ = c.Error(bindError(err))
+		return
+	}
 
-	response := StatusReport{
-		RemainingArtistsCount:  stillToBeDiscoveredCount,
-		AlreadyDiscoveredCount: alreadyDiscoveredCount,
+	component := c.Param("component")
+	if err := s.logLevels.SetLevel(component, request.Level); err != nil {
+		if errors.Is(err, logging.ErrUnknownComponent) {
+			_ = c.Error(newError(http.StatusNotFound, CodeNotFound, err.Error()))
+			return
+		}
+		if errors.Is(err, logging.ErrInactiveComponent) {
+			_ = c.Error(newError(http.StatusConflict, CodeConflict, err.Error()))
+			return
+		}
+		_ = c.Error(validationError([]ProblemDetail{{Field: "level", Message: err.Error()}}))
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	requestLogger(c, &s.Logger).Info("changed log level", zap.String("component", component), zap.String("level", request.Level))
+	c.JSON(http.StatusOK, LogLevelsResponse{Levels: s.logLevels.Levels()})
 }
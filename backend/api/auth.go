@@ -0,0 +1,203 @@
+package api
+
+import (
+	"backend/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeStatsRead      = "stats:read"
+	ScopeImportsWrite   = "imports:write"
+	ScopeDiscoveryAdmin = "discovery:admin"
+
+	apiKeyHeader        = "X-API-Key"
+	principalContextKey = "principal"
+	defaultSessionTTL   = 24 * time.Hour
+)
+
+var (
+	errInvalidToken = errors.New("invalid session token")
+	errExpiredToken = errors.New("session token expired")
+)
+
+// Principal is the authenticated caller, either resolved from a static API key or from a session token.
+type Principal struct {
+	Name      string    `json:"sub"`
+	User      string    `json:"user"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type Authenticator struct {
+	apiKeys       []config.ApiKeyConfig
+	sessionSecret []byte
+	sessionTTL    time.Duration
+}
+
+// NewAuthenticator returns nil if no auth configuration is present, which disables authentication.
+func NewAuthenticator(cfg *config.AuthConfig) *Authenticator {
+	if cfg == nil {
+		return nil
+	}
+
+	ttl := defaultSessionTTL
+	if cfg.SessionTTL != nil {
+		ttl = *cfg.SessionTTL
+	}
+
+	return &Authenticator{
+		apiKeys:       cfg.ApiKeys,
+		sessionSecret: []byte(cfg.SessionSecret),
+		sessionTTL:    ttl,
+	}
+}
+
+func (a *Authenticator) sessionsEnabled() bool {
+	return a != nil && len(a.sessionSecret) > 0
+}
+
+// Authenticate resolves the principal from the X-API-Key header or a bearer session token.
+// Requests without valid credentials are rejected with 401.
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a == nil {
+			c.Next()
+			return
+		}
+
+		principal, err := a.principalFromRequest(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="spotify-viz"`)
+			abortWithError(c, newError(http.StatusUnauthorized, CodeUnauthorized, err.Error()))
+			return
+		}
+
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// RequireScope rejects authenticated principals lacking the given scope with 403.
+func (a *Authenticator) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a == nil {
+			c.Next()
+			return
+		}
+
+		principal := currentPrincipal(c)
+		if principal == nil || !principal.HasScope(scope) {
+			abortWithError(c, newError(http.StatusForbidden, CodeForbidden, fmt.Sprintf("missing scope %s", scope)))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (a *Authenticator) principalFromRequest(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return a.principalForApiKey(key)
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if token, found := strings.CutPrefix(authorization, "Bearer "); found {
+		return a.verifySessionToken(strings.TrimSpace(token))
+	}
+
+	return nil, errors.New("missing credentials")
+}
+
+func (a *Authenticator) principalForApiKey(key string) (*Principal, error) {
+	for _, apiKey := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(apiKey.Key), []byte(key)) == 1 {
+			return &Principal{
+				Name:   apiKey.Name,
+				User:   apiKey.User,
+				Scopes: apiKey.Scopes,
+			}, nil
+		}
+	}
+
+	return nil, errors.New("invalid api key")
+}
+
+// IssueSessionToken signs a token carrying the principal's user and scopes, valid for the configured session TTL.
+func (a *Authenticator) IssueSessionToken(principal *Principal) (string, time.Time, error) {
+	expiresAt := time.Now().Add(a.sessionTTL).Truncate(time.Second)
+	payload, err := json.Marshal(Principal{
+		Name:      principal.Name,
+		User:      principal.User,
+		Scopes:    principal.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	signature := base64.RawURLEncoding.EncodeToString(a.sign(encodedPayload))
+
+	return encodedPayload + "." + signature, expiresAt, nil
+}
+
+func (a *Authenticator) verifySessionToken(token string) (*Principal, error) {
+	if !a.sessionsEnabled() {
+		return nil, errInvalidToken
+	}
+
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, errInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, a.sign(encodedPayload)) {
+		return nil, errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	var principal Principal
+	if err = json.Unmarshal(payload, &principal); err != nil {
+		return nil, errInvalidToken
+	}
+
+	if time.Now().After(principal.ExpiresAt) {
+		return nil, errExpiredToken
+	}
+
+	return &principal, nil
+}
+
+func (a *Authenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.sessionSecret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func currentPrincipal(c *gin.Context) *Principal {
+	principal, exists := c.Get(principalContextKey)
+	if !exists {
+		return nil
+	}
+	return principal.(*Principal)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"backend/config"
+	"backend/requestid"
+	"errors"
+	"github.com/gin-contrib/cors"
+	"slices"
+	"strings"
+)
+
+var (
+	defaultAllowOrigins  = []string{"http://localhost:5173"}
+	defaultAllowMethods  = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	defaultAllowHeaders  = []string{"Origin", "Content-Length", "Content-Type", "Accept", "Authorization", apiKeyHeader, userHeader, requestid.Header}
+	defaultExposeHeaders = []string{requestid.Header, "Retry-After"}
+)
+
+// buildCorsConfig translates the server's CORS settings into a gin-contrib/cors configuration.
+// Missing fields fall back to the local development setup of the frontend.
+func buildCorsConfig(cfg *config.CorsConfig) (cors.Config, error) {
+	if cfg == nil {
+		cfg = &config.CorsConfig{}
+	}
+
+	corsConfig := cors.Config{
+		AllowOrigins:     cfg.AllowOrigins,
+		AllowMethods:     cfg.AllowMethods,
+		AllowHeaders:     cfg.AllowHeaders,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+	}
+
+	if len(corsConfig.AllowOrigins) == 0 {
+		corsConfig.AllowOrigins = defaultAllowOrigins
+	}
+
+	if len(corsConfig.AllowMethods) == 0 {
+		corsConfig.AllowMethods = defaultAllowMethods
+	}
+
+	if len(corsConfig.AllowHeaders) == 0 {
+		corsConfig.AllowHeaders = defaultAllowHeaders
+	}
+
+	if len(corsConfig.ExposeHeaders) == 0 {
+		corsConfig.ExposeHeaders = defaultExposeHeaders
+	}
+
+	if cfg.MaxAge != nil {
+		corsConfig.MaxAge = *cfg.MaxAge
+	}
+
+	if slices.Contains(corsConfig.AllowOrigins, "*") {
+		if corsConfig.AllowCredentials {
+			return cors.Config{}, errors.New("cors: allow_credentials cannot be combined with the wildcard origin")
+		}
+		corsConfig.AllowAllOrigins = true
+		corsConfig.AllowOrigins = nil
+	} else if slices.ContainsFunc(corsConfig.AllowOrigins, func(origin string) bool {
+		return strings.Contains(origin, "*")
+	}) {
+		corsConfig.AllowWildcard = true
+	}
+
+	if err := corsConfig.Validate(); err != nil {
+		return cors.Config{}, err
+	}
+
+	return corsConfig, nil
+}
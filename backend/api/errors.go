@@ -0,0 +1,187 @@
+package api
+
+import (
+	"backend/db"
+	"backend/discovery"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	CodeBadRequest     = "bad_request"
+	CodeValidation     = "validation_failed"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeBodyTooLarge   = "body_too_large"
+	CodeTooManyArtists = "too_many_artists"
+	CodeRateLimited    = "rate_limited"
+	CodeUnavailable    = "service_unavailable"
+	CodeInternal       = "internal_error"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypeBase    = "https://spotify-viz/problems/"
+	internalMessage    = "internal server error"
+	unavailableMessage = "a required service is currently unavailable"
+)
+
+// Problem is the problem+json style body of every error response.
+type Problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	Details   []ProblemDetail `json:"details,omitempty"`
+	RequestID string          `json:"requestId,omitempty"`
+}
+
+// ProblemDetail points at a single offending field of a request.
+type ProblemDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error with a known HTTP representation. Handlers attach it via c.Error and ErrorHandler renders it.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details []ProblemDetail
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func validationError(details []ProblemDetail) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidation,
+		Message: "request validation failed",
+		Details: details,
+	}
+}
+
+// abortWithError stops the handler chain and leaves rendering to ErrorHandler.
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// ErrorHandler renders the last error attached to the context as problem+json. Server side errors are logged
+// with their cause while the client only receives a generic message, so database errors never leak.
+func ErrorHandler(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		apiErr := toApiError(err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			requestLogger(c, logger).Error("request failed",
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Int("status", apiErr.Status),
+				zap.Error(err),
+			)
+		}
+
+		renderProblem(c, apiErr)
+	}
+}
+
+// RecoverWithProblem turns panics into a logged 500 problem response instead of an empty body.
+func RecoverWithProblem(logger *zap.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		requestLogger(c, logger).Error("recovered from panic",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Any("panic", recovered),
+			zap.Stack("stacktrace"),
+		)
+		renderProblem(c, newError(http.StatusInternalServerError, CodeInternal, internalMessage))
+		c.Abort()
+	})
+}
+
+func renderProblem(c *gin.Context, apiErr *Error) {
+	problem := Problem{
+		Type:      problemTypeBase + strings.ReplaceAll(apiErr.Code, "_", "-"),
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		Details:   apiErr.Details,
+		RequestID: c.GetString(requestIdContextKey),
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.JSON(apiErr.Status, problem)
+}
+
+// toApiError maps typed domain errors of the db and discovery packages to their HTTP representation.
+func toApiError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return newError(http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, db.ErrNotFound):
+		return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: "resource not found", Err: err}
+	case errors.Is(err, db.ErrConflict):
+		return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: "resource already exists", Err: err}
+	case errors.Is(err, db.ErrUnavailable):
+		return &Error{Status: http.StatusServiceUnavailable, Code: CodeUnavailable, Message: unavailableMessage, Err: err}
+	case errors.Is(err, discovery.ErrInvalidTrackId):
+		return &Error{Status: http.StatusBadRequest, Code: CodeValidation, Message: err.Error(), Err: err}
+	default:
+		return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: internalMessage, Err: err}
+	}
+}
+
+// bindError turns json binding failures into a 400 naming the offending field where possible.
+func bindError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return err
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return validationError([]ProblemDetail{{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		}})
+	}
+
+	return &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "request body is not valid JSON", Err: err}
+}
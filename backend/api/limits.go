@@ -0,0 +1,140 @@
+package api
+
+import (
+	"backend/config"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRequestsPerSecond    = 10
+	defaultBurst                = 20
+	defaultMaxBodyBytes         = 8 << 20
+	defaultMaxArtistsPerRequest = 20_000
+
+	limiterIdleTimeout = 10 * time.Minute
+)
+
+// withLimitDefaults fills every unset limit with its default, so the API is always protected.
+func withLimitDefaults(cfg *config.LimitsConfig) config.LimitsConfig {
+	limits := config.LimitsConfig{}
+	if cfg != nil {
+		limits = *cfg
+	}
+
+	if limits.RequestsPerSecond <= 0 {
+		limits.RequestsPerSecond = defaultRequestsPerSecond
+	}
+
+	if limits.Burst <= 0 {
+		limits.Burst = defaultBurst
+	}
+
+	if limits.MaxBodyBytes <= 0 {
+		limits.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if limits.MaxArtistsPerRequest <= 0 {
+		limits.MaxArtistsPerRequest = defaultMaxArtistsPerRequest
+	}
+
+	return limits
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter hands out one token bucket per client IP.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	lock    sync.Mutex
+	clients map[string]*clientLimiter
+	// lastSweep is when idle clients were last removed, sweeps run at most once per limiterIdleTimeout.
+	lastSweep time.Time
+}
+
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		limit:     rate.Limit(requestsPerSecond),
+		burst:     burst,
+		clients:   make(map[string]*clientLimiter),
+		lastSweep: time.Now(),
+	}
+}
+
+func (r *RateLimiter) limiterFor(client string) *rate.Limiter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastSweep) > limiterIdleTimeout {
+		r.sweep(now)
+	}
+
+	entry, exists := r.clients[client]
+	if !exists {
+		entry = &clientLimiter{limiter: rate.NewLimiter(r.limit, r.burst)}
+		r.clients[client] = entry
+	}
+	entry.lastSeen = now
+
+	return entry.limiter
+}
+
+// sweep removes the clients idle for longer than limiterIdleTimeout. The caller holds the lock.
+func (r *RateLimiter) sweep(now time.Time) {
+	for key, entry := range r.clients {
+		if now.Sub(entry.lastSeen) > limiterIdleTimeout {
+			delete(r.clients, key)
+		}
+	}
+	r.lastSweep = now
+}
+
+// Middleware rejects requests of clients exceeding their bucket with 429 and a Retry-After header. Clients are
+// keyed by c.ClientIP, which only honors forwarding headers of the engine's trusted proxies.
+func (r *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reservation := r.limiterFor(c.ClientIP()).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			retryAfter := int(math.Ceil(delay.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			abortWithError(c, newError(
+				http.StatusTooManyRequests,
+				CodeRateLimited,
+				fmt.Sprintf("rate limit exceeded, retry in %d seconds", retryAfter),
+			))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MaxBodySize rejects requests announcing a larger body with 413 and caps the readable body for all others.
+func MaxBodySize(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			abortWithError(c, newError(
+				http.StatusRequestEntityTooLarge,
+				CodeBodyTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", maxBytes),
+			))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
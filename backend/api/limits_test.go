@@ -0,0 +1,55 @@
+package api
+
+import (
+	"backend/config"
+	"backend/health"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRateLimiterClientKey sends requests from one connection with a new X-Forwarded-For each time. Only a
+// trusted proxy may name the client, so a spoofed header must not hand out a fresh bucket.
+func TestRateLimiterClientKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		wantStatus     int
+	}{
+		{name: "no trusted proxies", wantStatus: http.StatusTooManyRequests},
+		{name: "untrusted proxy", trustedProxies: []string{"10.0.0.0/8"}, wantStatus: http.StatusTooManyRequests},
+		{name: "trusted proxy", trustedProxies: []string{"192.0.2.0/24"}, wantStatus: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, err := NewServer(zap.NewNop(), config.ApiServerConfig{
+				Limits:         &config.LimitsConfig{RequestsPerSecond: 0.001, Burst: 1},
+				TrustedProxies: test.trustedProxies,
+			}, nil, health.NewRegistry(zap.NewNop()), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var status int
+			for i := range 3 {
+				request := httptest.NewRequest(http.MethodGet, "/health/live", nil)
+				request.RemoteAddr = "192.0.2.1:40000"
+				request.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+
+				recorder := httptest.NewRecorder()
+				server.restApi.ServeHTTP(recorder, request)
+				status = recorder.Code
+			}
+
+			if status != test.wantStatus {
+				t.Errorf("want status %d for the last request, got %d", test.wantStatus, status)
+			}
+		})
+	}
+}
@@ -1,22 +1,164 @@
 package api
 
 import (
+	"backend/accesslog"
+	"backend/config"
+	"backend/db"
+	"backend/metrics"
+	"backend/requestid"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func ZapLogger(logger *zap.Logger) gin.HandlerFunc {
+const (
+	userHeader          = "X-User"
+	userContextKey      = "user"
+	requestIdContextKey = "request_id"
+)
+
+// RequestID accepts a valid X-Request-ID from the client or generates one, stores it in the gin and request
+// context and echoes it in the response headers.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.IsValid(id) {
+			id = requestid.Generate()
+		}
+
+		c.Set(requestIdContextKey, id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
+
+// requestLogger returns the logger enriched with the request id of the current request.
+func requestLogger(c *gin.Context, logger *zap.Logger) *zap.Logger {
+	return logger.With(zap.String("request_id", c.GetString(requestIdContextKey)))
+}
+
+// AccessLog writes an access log entry for every request once it is served, including requests rejected by
+// other middlewares. Failing writes are reported to logger.
+func AccessLog(accessLog *accesslog.Logger, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
 		c.Next()
-		duration := time.Since(start)
-
-		logger.Info("Request",
-			zap.String("method", c.Request.Method),
-			zap.String("path", c.Request.URL.Path),
-			zap.Int("status", c.Writer.Status()),
-			zap.Duration("duration", duration),
-		)
+
+		entry := accesslog.Entry{
+			Time:          start,
+			ClientIP:      c.ClientIP(),
+			User:          accessLogUser(c),
+			Method:        c.Request.Method,
+			Uri:           c.Request.RequestURI,
+			Route:         c.FullPath(),
+			Protocol:      c.Request.Proto,
+			Status:        c.Writer.Status(),
+			RequestBytes:  max(c.Request.ContentLength, 0),
+			ResponseBytes: int64(max(c.Writer.Size(), 0)),
+			Latency:       time.Since(start),
+			Referer:       c.Request.Referer(),
+			UserAgent:     c.Request.UserAgent(),
+			RequestID:     c.GetString(requestIdContextKey),
+		}
+
+		if err := accessLog.Log(entry); err != nil {
+			requestLogger(c, logger).Warn("failed to write access log", zap.Error(err))
+		}
+	}
+}
+
+// accessLogUser names the resolved user, falling back to the authenticated principal.
+func accessLogUser(c *gin.Context) string {
+	if user, exists := c.Get(userContextKey); exists {
+		return user.(*db.User).Name
+	}
+	if principal := currentPrincipal(c); principal != nil {
+		return principal.Name
+	}
+	return ""
+}
+
+// PrometheusMetrics records the duration of every request by route template and status.
+func PrometheusMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HttpRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// UserResolver identifies the calling user and stores it in the context. Authenticated principals are
+// bound to their configured user, the X-User header is only consulted when authentication is disabled and
+// userHeaderAllowed, as it lets any caller act as any user. Unknown users are created on first sight, so every
+// request below this middleware is scoped to a user.
+func UserResolver(database *gorm.DB, logger *zap.Logger, userHeaderAllowed bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var name string
+		if principal := currentPrincipal(c); principal != nil {
+			name = principal.User
+			if name == "" {
+				abortWithError(c, newError(http.StatusForbidden, CodeForbidden, "credentials are not bound to a user"))
+				return
+			}
+		} else if !userHeaderAllowed {
+			abortWithError(c, newError(http.StatusUnauthorized, CodeUnauthorized, "user routes require authentication"))
+			return
+		} else {
+			name = strings.TrimSpace(c.GetHeader(userHeader))
+			if name == "" {
+				abortWithError(c, newError(http.StatusUnauthorized, CodeUnauthorized, "X-User header is required"))
+				return
+			}
+		}
+
+		var user db.User
+		res := database.Where(db.User{Name: name}).FirstOrCreate(&user)
+		if res.Error != nil {
+			requestLogger(c, logger).Error("error resolving user", zap.String("user", name), zap.Error(res.Error))
+			abortWithError(c, db.Classify(res.Error))
+			return
+		}
+
+		c.Set(userContextKey, &user)
+		c.Next()
+	}
+}
+
+func currentUser(c *gin.Context) *db.User {
+	return c.MustGet(userContextKey).(*db.User)
+}
+
+// SecurityHeaders sets the configured security related response headers. Empty settings are skipped.
+func SecurityHeaders(cfg config.SecurityHeadersConfig) gin.HandlerFunc {
+	headers := map[string]string{
+		"X-Frame-Options":           cfg.FrameOptions,
+		"Referrer-Policy":           cfg.ReferrerPolicy,
+		"Content-Security-Policy":   cfg.ContentSecurityPolicy,
+		"Strict-Transport-Security": cfg.StrictTransportSecurity,
+	}
+	if cfg.ContentTypeNosniff {
+		headers["X-Content-Type-Options"] = "nosniff"
+	}
+
+	return func(c *gin.Context) {
+		for header, value := range headers {
+			if value != "" {
+				c.Header(header, value)
+			}
+		}
+		c.Next()
 	}
 }
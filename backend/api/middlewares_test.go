@@ -0,0 +1,47 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestUserResolverHeader checks that the X-User header is ignored unless it is explicitly allowed. Requests it
+// lets through would reach the database, so only the rejected ones are covered here.
+func TestUserResolverHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		allowed bool
+		user    string
+	}{
+		{name: "header without dev mode", user: "someone"},
+		{name: "no header without dev mode"},
+		{name: "no header in dev mode", allowed: true},
+		{name: "blank header in dev mode", allowed: true, user: "  "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(ErrorHandler(zap.NewNop()))
+			engine.GET("/me", UserResolver(nil, zap.NewNop(), test.allowed), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if test.user != "" {
+				request.Header.Set(userHeader, test.user)
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusUnauthorized {
+				t.Errorf("want status %d, got %d", http.StatusUnauthorized, recorder.Code)
+			}
+		})
+	}
+}
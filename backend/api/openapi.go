@@ -0,0 +1,14 @@
+package api
+
+import (
+	_ "embed"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+//go:embed openapi.json
+var openApiDocument []byte
+
+func handleGetOpenApiDocument(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openApiDocument)
+}
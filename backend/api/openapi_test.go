@@ -0,0 +1,609 @@
+package api
+
+import (
+	"backend/config"
+	"backend/health"
+	"backend/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frontendTypesFile holds the TypeScript types the frontend sends and receives, relative to this package.
+const frontendTypesFile = "../../frontend/src/discover/api/type.ts"
+
+// documentedSchemas maps the component schemas of openapi.json to the Go types serialized for them.
+var documentedSchemas = map[string]any{
+	"Problem":                  Problem{},
+	"ProblemDetail":            ProblemDetail{},
+	"DiscoveredArtist":         DiscoveredArtist{},
+	"DiscoveredArtistsRequest": DiscoveredArtistsRequest{},
+	"StatusReport":             StatusReport{},
+	"UserResponse":             UserResponse{},
+	"ImportResponse":           ImportResponse{},
+	"UserStatsReport":          UserStatsReport{},
+	"SessionResponse":          SessionResponse{},
+	"QueueClearedResponse":     QueueClearedResponse{},
+	"LogLevelsResponse":        LogLevelsResponse{},
+	"LogLevelRequest":          LogLevelRequest{},
+	"HealthReport":             health.Report{},
+	"HealthComponent":          health.ComponentStatus{},
+}
+
+// frontendSchemas maps the TypeScript types of frontendTypesFile to the schemas they mirror.
+var frontendSchemas = map[string]string{
+	"DiscoverArtistType":         "DiscoveredArtist",
+	"DiscoverArtistRequestType":  "DiscoveredArtistsRequest",
+	"DiscoverStatusResponseType": "StatusReport",
+	"UserStatsResponseType":      "UserStatsReport",
+	"HealthReportType":           "HealthReport",
+	"HealthComponentType":        "HealthComponent",
+}
+
+var (
+	tsTypePattern  = regexp.MustCompile(`(?s)type\s+(\w+)\s*=\s*\{(.*?)\}`)
+	tsFieldPattern = regexp.MustCompile(`(\w+)(\??)\s*:\s*([^;\n]+);?`)
+	// tsUnionPattern matches string literal unions like type HealthStatusType = 'up' | 'down';
+	tsUnionPattern = regexp.MustCompile(`type\s+(\w+)\s*=\s*('[^']*'(?:\s*\|\s*'[^']*')*)\s*;`)
+	tsLiteral      = regexp.MustCompile(`'([^']*)'`)
+
+	pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+type openApiSchema struct {
+	Type                 string                   `json:"type"`
+	Ref                  string                   `json:"$ref"`
+	Enum                 []string                 `json:"enum"`
+	Required             []string                 `json:"required"`
+	Properties           map[string]openApiSchema `json:"properties"`
+	Items                *openApiSchema           `json:"items"`
+	AdditionalProperties json.RawMessage          `json:"additionalProperties"`
+}
+
+type openApiResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *openApiSchema `json:"schema"`
+	} `json:"content"`
+}
+
+type openApiOperation struct {
+	Responses map[string]openApiResponse `json:"responses"`
+}
+
+type openApiServer struct {
+	Url string `json:"url"`
+}
+
+type openApiPath struct {
+	Servers []openApiServer   `json:"servers"`
+	Get     *openApiOperation `json:"get"`
+	Post    *openApiOperation `json:"post"`
+	Put     *openApiOperation `json:"put"`
+	Delete  *openApiOperation `json:"delete"`
+}
+
+func (p openApiPath) operations() map[string]*openApiOperation {
+	operations := make(map[string]*openApiOperation)
+	for method, operation := range map[string]*openApiOperation{
+		http.MethodGet:    p.Get,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodDelete: p.Delete,
+	} {
+		if operation != nil {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+type openApiSpec struct {
+	Servers    []openApiServer        `json:"servers"`
+	Paths      map[string]openApiPath `json:"paths"`
+	Components struct {
+		Schemas   map[string]openApiSchema   `json:"schemas"`
+		Responses map[string]openApiResponse `json:"responses"`
+	} `json:"components"`
+}
+
+// routePath is the gin route of a documented path, joined with its server url and with {param} as :param.
+func (s openApiSpec) routePath(path string) string {
+	servers := s.Paths[path].Servers
+	if len(servers) == 0 {
+		servers = s.Servers
+	}
+	return strings.TrimSuffix(servers[0].Url, "/") + pathParamPattern.ReplaceAllString(path, ":$1")
+}
+
+// operation finds the documented operation serving method and the request path urlPath.
+func (s openApiSpec) operation(method string, urlPath string) (*openApiOperation, bool) {
+	requested := strings.Split(urlPath, "/")
+	for path, item := range s.Paths {
+		segments := strings.Split(s.routePath(path), "/")
+		if len(segments) != len(requested) {
+			continue
+		}
+		matches := true
+		for i, segment := range segments {
+			if !strings.HasPrefix(segment, ":") && segment != requested[i] {
+				matches = false
+				break
+			}
+		}
+		if operation, exists := item.operations()[method]; matches && exists {
+			return operation, true
+		}
+	}
+	return nil, false
+}
+
+// TestOpenApiSchemas checks that every documented schema matches the json fields and types of its Go type,
+// so request and response structs can't drift from openapi.json unnoticed.
+func TestOpenApiSchemas(t *testing.T) {
+	spec := loadOpenApiSpec(t)
+
+	for name, value := range documentedSchemas {
+		t.Run(name, func(t *testing.T) {
+			schema, exists := spec.Components.Schemas[name]
+			if !exists {
+				t.Fatalf("schema %s is not documented", name)
+			}
+			for _, problem := range compareSchema(name, schema, reflect.TypeOf(value)) {
+				t.Error(problem)
+			}
+		})
+	}
+
+	for name := range spec.Components.Schemas {
+		if _, exists := documentedSchemas[name]; !exists {
+			t.Errorf("schema %s has no Go type", name)
+		}
+	}
+}
+
+// TestFrontendTypes checks the TypeScript types of the frontend against openapi.json, which in turn is checked
+// against the Go types by TestOpenApiSchemas.
+func TestFrontendTypes(t *testing.T) {
+	source, err := os.ReadFile(frontendTypesFile)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skipf("%s not found, the backend is checked out without the frontend", frontendTypesFile)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := loadOpenApiSpec(t)
+	declared := make(map[string]string)
+	for _, match := range tsTypePattern.FindAllStringSubmatch(string(source), -1) {
+		declared[match[1]] = match[2]
+	}
+	unions := make(map[string][]string)
+	for _, match := range tsUnionPattern.FindAllStringSubmatch(string(source), -1) {
+		for _, literal := range tsLiteral.FindAllStringSubmatch(match[2], -1) {
+			unions[match[1]] = append(unions[match[1]], literal[1])
+		}
+	}
+
+	for tsName, schemaName := range frontendSchemas {
+		t.Run(tsName, func(t *testing.T) {
+			body, exists := declared[tsName]
+			if !exists {
+				t.Fatalf("type %s is not declared in %s", tsName, frontendTypesFile)
+			}
+			schema, exists := spec.Components.Schemas[schemaName]
+			if !exists {
+				t.Fatalf("schema %s is not documented", schemaName)
+			}
+			for _, problem := range compareTsType(tsName, body, schema, unions) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// TestOpenApiPaths checks that the documented paths are exactly the routes of a server with every optional
+// route enabled.
+func TestOpenApiPaths(t *testing.T) {
+	spec := loadOpenApiSpec(t)
+	server := newSpecServer(t, nil)
+
+	served := make(map[string]bool)
+	for _, route := range server.restApi.Routes() {
+		served[route.Method+" "+route.Path] = true
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item.operations() {
+			documented[method+" "+spec.routePath(path)] = true
+		}
+	}
+
+	for route := range served {
+		if !documented[route] {
+			t.Errorf("route %s is not documented", route)
+		}
+	}
+	for route := range documented {
+		if !served[route] {
+			t.Errorf("%s is documented but not served", route)
+		}
+	}
+}
+
+// TestOpenApiResponses sends requests through the router and checks that their status, content type and body
+// are documented. The database is unreachable, so routes depending on it answer with their documented 503.
+func TestOpenApiResponses(t *testing.T) {
+	spec := loadOpenApiSpec(t)
+	var databaseDown bool
+	server := newSpecServer(t, func(ctx context.Context) health.ComponentStatus {
+		if databaseDown {
+			return health.ComponentStatus{Status: health.StatusDown, Message: "database is unreachable"}
+		}
+		return health.ComponentStatus{Status: health.StatusUp, Details: map[string]any{"openConnections": 1}}
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		apiKey       string
+		body         string
+		databaseDown bool
+		wantStatus   int
+	}{
+		{name: "health", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+		{name: "liveness", method: http.MethodGet, path: "/health/live", wantStatus: http.StatusOK},
+		{name: "ready", method: http.MethodGet, path: "/health/ready", wantStatus: http.StatusOK},
+		{name: "not ready", method: http.MethodGet, path: "/health/ready", databaseDown: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "metrics", method: http.MethodGet, path: "/metrics", wantStatus: http.StatusOK},
+		{name: "openapi document", method: http.MethodGet, path: "/api/v1/openapi.json", wantStatus: http.StatusOK},
+		{name: "missing credentials", method: http.MethodGet, path: "/api/v1/discover/status", wantStatus: http.StatusUnauthorized},
+		{name: "status without database", method: http.MethodGet, path: "/api/v1/discover/status", apiKey: specUserKey, wantStatus: http.StatusServiceUnavailable},
+		{name: "session", method: http.MethodPost, path: "/api/v1/auth/session", apiKey: specUserKey, wantStatus: http.StatusOK},
+		{name: "missing scope", method: http.MethodGet, path: "/api/v1/admin/log-levels", apiKey: specUserKey, wantStatus: http.StatusForbidden},
+		{name: "credentials without user", method: http.MethodGet, path: "/api/v1/me", apiKey: specAdminKey, wantStatus: http.StatusForbidden},
+		{name: "user without database", method: http.MethodGet, path: "/api/v1/me", apiKey: specUserKey, wantStatus: http.StatusServiceUnavailable},
+		{name: "imports without database", method: http.MethodGet, path: "/api/v1/me/imports", apiKey: specUserKey, wantStatus: http.StatusServiceUnavailable},
+		{name: "stats without database", method: http.MethodGet, path: "/api/v1/me/stats", apiKey: specUserKey, wantStatus: http.StatusServiceUnavailable},
+		{name: "clear queue without database", method: http.MethodDelete, path: "/api/v1/admin/discover/queue", apiKey: specAdminKey, wantStatus: http.StatusServiceUnavailable},
+		{name: "log levels", method: http.MethodGet, path: "/api/v1/admin/log-levels", apiKey: specAdminKey, wantStatus: http.StatusOK},
+		{name: "set log level", method: http.MethodPut, path: "/api/v1/admin/log-levels/api", apiKey: specAdminKey, body: `{"level":"debug"}`, wantStatus: http.StatusOK},
+		{name: "invalid log level", method: http.MethodPut, path: "/api/v1/admin/log-levels/api", apiKey: specAdminKey, body: `{"level":"loud"}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown log component", method: http.MethodPut, path: "/api/v1/admin/log-levels/unknown", apiKey: specAdminKey, body: `{"level":"debug"}`, wantStatus: http.StatusNotFound},
+		{name: "log component of another process", method: http.MethodPut, path: "/api/v1/admin/log-levels/discovery", apiKey: specAdminKey, body: `{"level":"debug"}`, wantStatus: http.StatusConflict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			databaseDown = test.databaseDown
+
+			var body io.Reader
+			if test.body != "" {
+				body = strings.NewReader(test.body)
+			}
+			request := httptest.NewRequest(test.method, test.path, body)
+			if test.body != "" {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			if test.apiKey != "" {
+				request.Header.Set(apiKeyHeader, test.apiKey)
+			}
+
+			recorder := httptest.NewRecorder()
+			server.restApi.ServeHTTP(recorder, request)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("want status %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+
+			operation, exists := spec.operation(test.method, test.path)
+			if !exists {
+				t.Fatalf("%s %s is not documented", test.method, test.path)
+			}
+			for _, problem := range validateResponse(spec, operation, recorder) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+const (
+	specUserKey  = "spec-user-key"
+	specAdminKey = "spec-admin-key"
+)
+
+// newSpecServer builds a server with every optional route enabled on a database that can't be reached. check
+// is registered as the only critical health check if given.
+func newSpecServer(t *testing.T, check health.CheckFunc) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	database, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := logging.New(config.LoggingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := health.NewRegistry(zap.NewNop())
+	if check != nil {
+		registry.Register("database", true, check)
+	}
+
+	sessionTTL := time.Hour
+	server, err := NewServer(zap.NewNop(), config.ApiServerConfig{
+		Auth: &config.AuthConfig{
+			SessionSecret: "spec-session-secret",
+			SessionTTL:    &sessionTTL,
+			ApiKeys: []config.ApiKeyConfig{
+				{Name: "user", Key: specUserKey, User: "spec", Scopes: []string{ScopeStatsRead}},
+				{Name: "admin", Key: specAdminKey, Scopes: []string{ScopeStatsRead, ScopeImportsWrite, ScopeDiscoveryAdmin}},
+			},
+		},
+		Limits: &config.LimitsConfig{RequestsPerSecond: 1000, Burst: 1000},
+	}, database, registry, logs.Levels.Only(logging.ComponentApp, logging.ComponentApi), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// validateResponse checks the recorded response against the responses documented for operation.
+func validateResponse(spec openApiSpec, operation *openApiOperation, recorder *httptest.ResponseRecorder) []string {
+	response, exists := operation.Responses[strconv.Itoa(recorder.Code)]
+	if !exists {
+		return []string{fmt.Sprintf("status %d is not documented", recorder.Code)}
+	}
+	if name, isRef := strings.CutPrefix(response.Ref, "#/components/responses/"); isRef {
+		response = spec.Components.Responses[name]
+	}
+	if len(response.Content) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := strings.Cut(recorder.Header().Get("Content-Type"), ";")
+	content, exists := response.Content[strings.TrimSpace(mediaType)]
+	if !exists {
+		return []string{fmt.Sprintf("content type %s of status %d is not documented", mediaType, recorder.Code)}
+	}
+	if content.Schema == nil || content.Schema.Type == "string" {
+		return nil
+	}
+
+	var body any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		return []string{fmt.Sprintf("body is not valid json: %v", err)}
+	}
+	return validateValue(spec, "body", *content.Schema, body)
+}
+
+// validateValue checks a decoded json value against schema, resolving references to component schemas.
+func validateValue(spec openApiSpec, path string, schema openApiSchema, value any) []string {
+	if name, isRef := strings.CutPrefix(schema.Ref, "#/components/schemas/"); isRef {
+		schema = spec.Components.Schemas[name]
+	}
+
+	var problems []string
+	switch schema.Type {
+	case "object":
+		object, isObject := value.(map[string]any)
+		if !isObject {
+			return []string{fmt.Sprintf("%s is %T, documented as object", path, value)}
+		}
+		for _, required := range schema.Required {
+			if _, exists := object[required]; !exists {
+				problems = append(problems, path+"."+required+" is required but missing")
+			}
+		}
+		for field, fieldValue := range object {
+			if property, documented := schema.Properties[field]; documented {
+				problems = append(problems, validateValue(spec, path+"."+field, property, fieldValue)...)
+				continue
+			}
+
+			var additional openApiSchema
+			switch {
+			case len(schema.AdditionalProperties) == 0:
+				problems = append(problems, path+"."+field+" is not documented")
+			case json.Unmarshal(schema.AdditionalProperties, &additional) == nil:
+				problems = append(problems, validateValue(spec, path+"."+field, additional, fieldValue)...)
+			}
+		}
+	case "array":
+		items, isArray := value.([]any)
+		if !isArray {
+			return []string{fmt.Sprintf("%s is %T, documented as array", path, value)}
+		}
+		for i, item := range items {
+			problems = append(problems, validateValue(spec, fmt.Sprintf("%s[%d]", path, i), *schema.Items, item)...)
+		}
+	case "string":
+		text, isString := value.(string)
+		if !isString {
+			return []string{fmt.Sprintf("%s is %T, documented as string", path, value)}
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, text) {
+			problems = append(problems, fmt.Sprintf("%s is %q, documented as one of %v", path, text, schema.Enum))
+		}
+	case "integer", "number":
+		number, isNumber := value.(float64)
+		if !isNumber {
+			return []string{fmt.Sprintf("%s is %T, documented as %s", path, value, schema.Type)}
+		}
+		if schema.Type == "integer" && number != math.Trunc(number) {
+			problems = append(problems, fmt.Sprintf("%s is %g, documented as integer", path, number))
+		}
+	case "boolean":
+		if _, isBool := value.(bool); !isBool {
+			problems = append(problems, fmt.Sprintf("%s is %T, documented as boolean", path, value))
+		}
+	}
+	return problems
+}
+
+func loadOpenApiSpec(t *testing.T) openApiSpec {
+	t.Helper()
+
+	var spec openApiSpec
+	if err := json.Unmarshal(openApiDocument, &spec); err != nil {
+		t.Fatalf("invalid openapi document: %v", err)
+	}
+	return spec
+}
+
+func compareSchema(name string, schema openApiSchema, goType reflect.Type) []string {
+	var problems []string
+	fields := jsonFields(goType)
+
+	for property, propertySchema := range schema.Properties {
+		fieldType, exists := fields[property]
+		if !exists {
+			problems = append(problems, name+"."+property+" is documented but not serialized")
+			continue
+		}
+
+		expected := openApiType(fieldType)
+		if propertySchema.Ref != "" {
+			if expected != "object" {
+				problems = append(problems, name+"."+property+" references a schema but is "+expected)
+			}
+			continue
+		}
+
+		if propertySchema.Type != expected {
+			problems = append(problems, name+"."+property+" is documented as "+propertySchema.Type+" but is "+expected)
+		}
+	}
+
+	for field := range fields {
+		if _, exists := schema.Properties[field]; !exists {
+			problems = append(problems, name+"."+field+" is serialized but not documented")
+		}
+	}
+
+	return problems
+}
+
+func compareTsType(name string, body string, schema openApiSchema, unions map[string][]string) []string {
+	var problems []string
+	fields := make(map[string]bool)
+
+	for _, match := range tsFieldPattern.FindAllStringSubmatch(body, -1) {
+		field, optional, tsType := match[1], match[2] == "?", strings.TrimSpace(match[3])
+		fields[field] = true
+
+		propertySchema, exists := schema.Properties[field]
+		if !exists {
+			problems = append(problems, name+"."+field+" is not documented")
+			continue
+		}
+
+		expected := propertySchema.Type
+		if propertySchema.Ref != "" {
+			expected = "object"
+		}
+		if literals, isUnion := unions[tsType]; isUnion {
+			if expected != "string" || !slices.Equal(literals, propertySchema.Enum) {
+				problems = append(problems, name+"."+field+" is "+strings.Join(literals, " | ")+" but documented as "+expected+" of "+strings.Join(propertySchema.Enum, " | "))
+			}
+		} else if actual := tsOpenApiType(tsType); actual != expected && !(actual == "number" && expected == "integer") {
+			problems = append(problems, name+"."+field+" is "+tsType+" but documented as "+expected)
+		}
+
+		if required := slices.Contains(schema.Required, field); required == optional {
+			problems = append(problems, name+"."+field+" is optional in only one of TypeScript and openapi.json")
+		}
+	}
+
+	for property := range schema.Properties {
+		if !fields[property] {
+			problems = append(problems, name+"."+property+" is documented but missing")
+		}
+	}
+
+	return problems
+}
+
+func tsOpenApiType(tsType string) string {
+	switch {
+	case tsType == "string":
+		return "string"
+	case tsType == "number":
+		return "number"
+	case tsType == "boolean":
+		return "boolean"
+	case strings.HasSuffix(tsType, "[]"):
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func jsonFields(goType reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < goType.NumField(); i++ {
+		field := goType.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func openApiType(goType reflect.Type) string {
+	for goType.Kind() == reflect.Pointer {
+		goType = goType.Elem()
+	}
+
+	if goType == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+
+	switch goType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -1,5 +1,11 @@
 package api
 
+import (
+	"backend/discovery"
+	"fmt"
+	"strings"
+)
+
 type DiscoveredArtist struct {
 	ArtistName string `json:"artistName"`
 	TrackUri   string `json:"trackUri"`
@@ -8,3 +14,38 @@ type DiscoveredArtist struct {
 type DiscoveredArtistsRequest struct {
 	Artists *[]DiscoveredArtist `json:"artists,omitempty"`
 }
+
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// Validate reports every missing or malformed field of the request.
+func (r DiscoveredArtistsRequest) Validate() []ProblemDetail {
+	if r.Artists == nil || len(*r.Artists) == 0 {
+		return []ProblemDetail{{Field: "artists", Message: "at least one artist is required"}}
+	}
+
+	var details []ProblemDetail
+	for i, artist := range *r.Artists {
+		if strings.TrimSpace(artist.ArtistName) == "" {
+			details = append(details, ProblemDetail{
+				Field:   fmt.Sprintf("artists[%d].artistName", i),
+				Message: "is required",
+			})
+		}
+
+		if artist.TrackUri == "" {
+			details = append(details, ProblemDetail{
+				Field:   fmt.Sprintf("artists[%d].trackUri", i),
+				Message: "is required",
+			})
+		} else if err := discovery.ValidateTrackId(artist.TrackUri); err != nil {
+			details = append(details, ProblemDetail{
+				Field:   fmt.Sprintf("artists[%d].trackUri", i),
+				Message: "must be a 22 character base62 Spotify track id",
+			})
+		}
+	}
+
+	return details
+}
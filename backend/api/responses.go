@@ -1,6 +1,41 @@
 package api
 
+import "time"
+
 type StatusReport struct {
 	RemainingArtistsCount  int64 `json:"remainingArtistsCount"`
 	AlreadyDiscoveredCount int64 `json:"alreadyDiscoveredCount"`
 }
+
+type UserResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ImportResponse struct {
+	ID         uint      `json:"id"`
+	TrackCount int       `json:"trackCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type UserStatsReport struct {
+	ImportsCount          int64 `json:"importsCount"`
+	TracksCount           int64 `json:"tracksCount"`
+	DiscoveredTracksCount int64 `json:"discoveredTracksCount"`
+	RemainingTracksCount  int64 `json:"remainingTracksCount"`
+}
+
+type SessionResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Scopes    []string  `json:"scopes"`
+}
+
+type QueueClearedResponse struct {
+	Removed int64 `json:"removed"`
+}
+
+type LogLevelsResponse struct {
+	Levels map[string]string `json:"levels"`
+}
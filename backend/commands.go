@@ -0,0 +1,417 @@
+package main
+
+import (
+	"backend/accesslog"
+	"backend/api"
+	"backend/db"
+	"backend/discovery"
+	"backend/health"
+	"backend/leader"
+	"backend/logging"
+	"backend/mockserver"
+	"backend/requestid"
+	"backend/spotifyapi"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	leaderRetryInterval   = 10 * time.Second
+	leaderShutdownTimeout = 30 * time.Second
+)
+
+// runAll starts the API server, the discovery worker and, if configured, the mock server in one process.
+func runAll(app *application, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	dbConn, err := app.prepareDatabase()
+	if err != nil {
+		return err
+	}
+
+	spotifyClient := app.newSpotifyClient()
+	worker := app.newWorker(dbConn, spotifyClient)
+	listenerState := &health.ListenerState{}
+	elector, err := app.newElector(dbConn)
+	if err != nil {
+		return err
+	}
+
+	healthRegistry := health.NewRegistry(app.logger)
+	healthRegistry.Register("database", true, health.DatabaseCheck(dbConn))
+	healthRegistry.Register("listener", true, health.LeaderOnly(elector.IsLeader, listenerState.Check))
+	healthRegistry.Register("spotify", false, health.LeaderOnly(elector.IsLeader, health.SpotifyLoginCheck(spotifyClient)))
+	healthRegistry.Register("worker", false, health.LeaderOnly(elector.IsLeader, health.WorkerCheck(worker, 2*(*app.cfg.DiscoverConfig.RetryInterval)+time.Minute)))
+	healthRegistry.Register("queue", false, health.QueueCheck(dbConn, *app.cfg.DiscoverConfig.MaxQueueAge))
+
+	stopDiscovery := app.startDiscovery(elector, worker, listenerState)
+	defer stopDiscovery()
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	app.watchConfig(watchCtx, worker, spotifyClient)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- app.runApiServer(dbConn, healthRegistry, app.logging.Levels)
+	}()
+	if app.cfg.MockServerConfig != nil {
+		go func() {
+			errs <- app.runMockServer()
+		}()
+	}
+
+	return app.waitForShutdown(errs)
+}
+
+// runServe only runs the API server, any number of replicas can be started. Imports are queued and announced
+// via NOTIFY for the worker processes.
+func runServe(app *application, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	dbConn, err := app.prepareDatabase()
+	if err != nil {
+		return err
+	}
+
+	healthRegistry := health.NewRegistry(app.logger)
+	healthRegistry.Register("database", true, health.DatabaseCheck(dbConn))
+	healthRegistry.Register("queue", false, health.QueueCheck(dbConn, *app.cfg.DiscoverConfig.MaxQueueAge))
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	app.watchConfig(watchCtx, nil, nil)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- app.runApiServer(dbConn, healthRegistry, app.logging.Levels.Only(logging.ComponentApp, logging.ComponentApi))
+	}()
+
+	return app.waitForShutdown(errs)
+}
+
+// runWorker only runs the discovery worker. Several worker processes can be started for failover, only the
+// elected leader discovers, woken up by notifications and the retry interval.
+func runWorker(app *application, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	dbConn, err := app.prepareDatabase()
+	if err != nil {
+		return err
+	}
+
+	elector, err := app.newElector(dbConn)
+	if err != nil {
+		return err
+	}
+
+	spotifyClient := app.newSpotifyClient()
+	worker := app.newWorker(dbConn, spotifyClient)
+	stopDiscovery := app.startDiscovery(elector, worker, &health.ListenerState{})
+	defer stopDiscovery()
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	app.watchConfig(watchCtx, worker, spotifyClient)
+
+	return app.waitForShutdown(nil)
+}
+
+// runMock runs the Spotify mock server standalone, no database is needed.
+func runMock(app *application, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	app.watchConfig(watchCtx, nil, nil)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- app.runMockServer()
+	}()
+
+	return app.waitForShutdown(errs)
+}
+
+// runImport queues the tracks of a Streaming_History JSON export for discovery, like POST /discover does.
+func runImport(app *application, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	userName := flags.String("user", "default", "name of the user the history belongs to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: import [-user name] <file>")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tracks, skipped, err := discovery.ReadStreamingHistory(file)
+	if err != nil {
+		return err
+	}
+
+	dbConn, err := app.prepareDatabase()
+	if err != nil {
+		return err
+	}
+
+	ctx := requestid.NewContext(context.Background(), requestid.Generate())
+	user, err := findOrCreateUser(ctx, dbConn, *userName)
+	if err != nil {
+		return err
+	}
+
+	dbImport, err := discovery.Enqueue(ctx, dbConn, user.ID, requestid.FromContext(ctx), tracks)
+	if err != nil {
+		return db.Classify(err)
+	}
+
+	if err = discovery.Notify(ctx, dbConn); err != nil {
+		app.logger.Warn("error notifying discovery worker", zap.Error(err))
+	}
+
+	fmt.Printf("import %d: queued %d tracks for user %s, skipped %d entries\n", dbImport.ID, len(tracks), user.Name, skipped)
+	return nil
+}
+
+// runDiscover runs the discovery worker. With -once the queue is processed a single time without waiting
+// for notifications, unless a worker process currently holds the discovery leadership.
+func runDiscover(app *application, args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ContinueOnError)
+	once := flags.Bool("once", false, "process the queue once and exit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if !*once {
+		return runWorker(app, flags.Args())
+	}
+
+	dbConn, err := app.prepareDatabase()
+	if err != nil {
+		return err
+	}
+
+	elector, err := app.newElector(dbConn)
+	if err != nil {
+		return err
+	}
+
+	worker := app.newWorker(dbConn, app.newSpotifyClient())
+	acquired, err := elector.RunOnce(context.Background(), worker.Run)
+	if err != nil {
+		return db.Classify(err)
+	}
+	if !acquired {
+		return errors.New("discovery is already running in another process")
+	}
+
+	stats, err := discovery.GetQueueStats(context.Background(), dbConn)
+	if err != nil {
+		return db.Classify(err)
+	}
+
+	fmt.Printf("discovery finished, %d artists remaining\n", stats.RemainingArtistsCount)
+	return nil
+}
+
+// runStats prints the discovery queue status and, with -user, the stats of that user.
+func runStats(app *application, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	userName := flags.String("user", "", "also print the stats of this user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dbConn, err := app.prepareDatabase()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	queueStats, err := discovery.GetQueueStats(ctx, dbConn)
+	if err != nil {
+		return db.Classify(err)
+	}
+
+	fmt.Printf("discovered artists:  %d\n", queueStats.AlreadyDiscoveredCount)
+	fmt.Printf("remaining artists:   %d\n", queueStats.RemainingArtistsCount)
+
+	if *userName == "" {
+		return nil
+	}
+
+	var user db.User
+	if res := dbConn.Where(db.User{Name: *userName}).First(&user); res.Error != nil {
+		return db.Classify(res.Error)
+	}
+
+	userStats, err := discovery.GetUserStats(ctx, dbConn, user.ID)
+	if err != nil {
+		return db.Classify(err)
+	}
+
+	fmt.Printf("\nuser %s\n", user.Name)
+	fmt.Printf("imports:             %d\n", userStats.ImportsCount)
+	fmt.Printf("tracks:              %d\n", userStats.TracksCount)
+	fmt.Printf("discovered tracks:   %d\n", userStats.DiscoveredTracksCount)
+	fmt.Printf("remaining tracks:    %d\n", userStats.RemainingTracksCount)
+	return nil
+}
+
+func findOrCreateUser(ctx context.Context, dbConn *gorm.DB, name string) (*db.User, error) {
+	var user db.User
+	if res := dbConn.WithContext(ctx).Where(db.User{Name: name}).FirstOrCreate(&user); res.Error != nil {
+		return nil, db.Classify(res.Error)
+	}
+	return &user, nil
+}
+
+func (app *application) newElector(dbConn *gorm.DB) (*leader.Elector, error) {
+	sqlDB, err := dbConn.DB()
+	if err != nil {
+		return nil, err
+	}
+	return leader.NewElector(sqlDB, discovery.LeaderLockKey, leaderRetryInterval, app.logger), nil
+}
+
+// startDiscovery campaigns for the discovery leadership in the background. The returned function ends the
+// campaign and waits for the current term, so the lock is released for the other replicas on shutdown.
+func (app *application) startDiscovery(elector *leader.Elector, worker *discovery.DiscoverWorker, listenerState *health.ListenerState) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		elector.Run(ctx, func(leaderCtx context.Context) {
+			newListener := func() *pq.Listener { return app.newListener(listenerState) }
+			retryInterval := func() time.Duration { return *app.live.Load().DiscoverConfig.RetryInterval }
+			discovery.RunLoop(leaderCtx, worker, newListener, listenerState, retryInterval, app.logger)
+		})
+	}()
+
+	return func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(leaderShutdownTimeout):
+			app.logger.Warn("discovery did not stop in time")
+		}
+	}
+}
+
+// runApiServer serves the API, its log level routes control logLevels, the components running in this process.
+func (app *application) runApiServer(dbConn *gorm.DB, healthRegistry *health.Registry, logLevels *logging.Levels) error {
+	accessLog, err := app.newAccessLog()
+	if err != nil {
+		return err
+	}
+
+	apiServer, err := api.NewServer(app.logging.Component(logging.ComponentApi), *app.cfg.Server, dbConn, healthRegistry, logLevels, accessLog)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+
+	if err = apiServer.Run(); err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	return nil
+}
+
+// newAccessLog opens the configured access log, nil if it is disabled.
+func (app *application) newAccessLog() (*accesslog.Logger, error) {
+	cfg := app.cfg.Server.AccessLog
+	if !*cfg.Enabled {
+		return nil, nil
+	}
+
+	var writer io.Writer = os.Stdout
+	if cfg.File != nil {
+		file := logging.NewRotatingFile(*cfg.File, app.cfg.Logging.Rotation)
+		app.closers = append(app.closers, file)
+		writer = file
+	}
+
+	return accesslog.New(writer, cfg.Format)
+}
+
+func (app *application) runMockServer() error {
+	app.logger.Info("Starting Mock Server")
+	mckSrv := &mockserver.Server{
+		Logger:       app.logger,
+		Port:         app.cfg.MockServerConfig.Port,
+		Seed:         app.cfg.MockServerConfig.Seed,
+		Fallback:     app.cfg.MockServerConfig.Fallback,
+		Scenarios:    app.cfg.MockServerConfig.Scenarios,
+		ClientID:     app.cfg.MockServerConfig.ClientID,
+		ClientSecret: app.cfg.MockServerConfig.ClientSecret,
+	}
+
+	if err := mckSrv.SetScenario(app.cfg.MockServerConfig.Scenario); err != nil {
+		return err
+	}
+
+	if dir := app.cfg.MockServerConfig.Fixtures; dir != "" {
+		fixtures, err := mockserver.LoadFixtures(dir)
+		if err != nil {
+			return fmt.Errorf("failed to load mock server fixtures: %w", err)
+		}
+		mckSrv.Fixtures = fixtures
+		app.logger.Info("loaded mock server fixtures",
+			zap.String("dir", dir),
+			zap.Int("tracks", fixtures.Count("tracks")),
+			zap.Int("artists", fixtures.Count("artists")),
+			zap.Int("albums", fixtures.Count("albums")),
+		)
+	}
+
+	if record := app.cfg.MockServerConfig.Record; record != nil {
+		mckSrv.Upstream = spotifyapi.NewSpotifyClient(*record, app.logging.Component(logging.ComponentSpotify))
+		app.logger.Info("recording Spotify responses without fixture",
+			zap.String("upstream", record.BaseApiUrl),
+			zap.String("dir", app.cfg.MockServerConfig.Fixtures),
+		)
+	}
+
+	if err := mckSrv.RunSpotifyMockServer(); err != nil {
+		return fmt.Errorf("failed to start mock server: %w", err)
+	}
+	return nil
+}
+
+// waitForShutdown blocks until SIGINT or SIGTERM is received or one of the servers fails.
+func (app *application) waitForShutdown(errs <-chan error) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-signals:
+		app.logger.Info("shutting down")
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
@@ -1,31 +1,165 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
 	"gopkg.in/yaml.v3"
-	"log"
 	"os"
 	"time"
 )
 
 type Config struct {
-	Server  *ApiServerConfig `yaml:"server"`
-	Logging struct {
-		Zap     *string `yaml:"zap"`
-		File    *string `yaml:"file"`
-		ApiFile *string `yaml:"api_file"`
-	}
+	Server           *ApiServerConfig  `yaml:"server"`
+	Logging          LoggingConfig     `yaml:"logging"`
 	MockServerConfig *MockServerConfig `yaml:"mock_server,omitempty"`
 	SpotifyConfig    *SpotifyConfig    `yaml:"spotify,omitempty"`
 	DatabaseConfig   *DatabaseConfig   `yaml:"database,omitempty"`
 	DiscoverConfig   *DiscoverConfig   `yaml:"discover,omitempty"`
+	TracingConfig    *TracingConfig    `yaml:"tracing,omitempty"`
+}
+
+type LoggingConfig struct {
+	Zap   *string `yaml:"zap"`
+	Level *string `yaml:"level,omitempty"`
+	// Components overrides Level for the api, discovery and spotifyapi loggers.
+	Components map[string]string `yaml:"components,omitempty"`
+	Sinks      *LogSinksConfig   `yaml:"sinks,omitempty"`
+	File       *string           `yaml:"file"`
+	// ApiFile is no longer used. It is only parsed to warn configs still setting it about server.access_log.file.
+	ApiFile  *string            `yaml:"api_file,omitempty"`
+	Rotation *LogRotationConfig `yaml:"rotation,omitempty"`
+}
+
+// LogSinksConfig sets the minimum level per output, on top of the component levels.
+type LogSinksConfig struct {
+	Console string `yaml:"console,omitempty"`
+	File    string `yaml:"file,omitempty"`
+	Json    string `yaml:"json,omitempty"`
+}
+
+// LogRotationConfig configures the rotation of log files. Files are only rotated once they reach MaxSizeMB,
+// never on a schedule. MaxAgeDays and MaxBackups only prune rotated files, a quiet log stays in one file.
+type LogRotationConfig struct {
+	MaxSizeMB  int   `yaml:"max_size_mb,omitempty"`
+	MaxAgeDays int   `yaml:"max_age_days,omitempty"`
+	MaxBackups int   `yaml:"max_backups,omitempty"`
+	Compress   *bool `yaml:"compress,omitempty"`
 }
 
 type ApiServerConfig struct {
-	Port int `yaml:"port"`
+	Port            int                    `yaml:"port"`
+	Auth            *AuthConfig            `yaml:"auth,omitempty"`
+	Cors            *CorsConfig            `yaml:"cors,omitempty"`
+	SecurityHeaders *SecurityHeadersConfig `yaml:"security_headers,omitempty"`
+	Limits          *LimitsConfig          `yaml:"limits,omitempty"`
+	AccessLog       *AccessLogConfig       `yaml:"access_log,omitempty"`
+	// DevMode identifies users by the X-User header when auth is disabled. Anyone can then read the data of
+	// any user, so it is meant for local development only. Without auth and DevMode user routes answer 401.
+	DevMode bool `yaml:"dev_mode,omitempty"`
+	// TrustedProxies lists the IPs and CIDRs whose X-Forwarded-For and X-Real-IP headers name the client.
+	// None are trusted by default, clients are then identified by the address they connect from.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+}
+
+// AccessLogConfig configures the API access log, written to stdout unless a file is given. The file is
+// rotated like the application log.
+type AccessLogConfig struct {
+	Enabled *bool   `yaml:"enabled,omitempty"`
+	Format  string  `yaml:"format,omitempty"`
+	File    *string `yaml:"file,omitempty"`
+}
+
+type LimitsConfig struct {
+	RequestsPerSecond    float64 `yaml:"requests_per_second,omitempty"`
+	Burst                int     `yaml:"burst,omitempty"`
+	MaxBodyBytes         int64   `yaml:"max_body_bytes,omitempty"`
+	MaxArtistsPerRequest int     `yaml:"max_artists_per_request,omitempty"`
+}
+
+type CorsConfig struct {
+	AllowOrigins     []string       `yaml:"allow_origins,omitempty"`
+	AllowMethods     []string       `yaml:"allow_methods,omitempty"`
+	AllowHeaders     []string       `yaml:"allow_headers,omitempty"`
+	ExposeHeaders    []string       `yaml:"expose_headers,omitempty"`
+	AllowCredentials bool           `yaml:"allow_credentials,omitempty"`
+	MaxAge           *time.Duration `yaml:"max_age,omitempty"`
+}
+
+type SecurityHeadersConfig struct {
+	ContentTypeNosniff      bool   `yaml:"content_type_nosniff,omitempty"`
+	FrameOptions            string `yaml:"frame_options,omitempty"`
+	ReferrerPolicy          string `yaml:"referrer_policy,omitempty"`
+	ContentSecurityPolicy   string `yaml:"content_security_policy,omitempty"`
+	StrictTransportSecurity string `yaml:"strict_transport_security,omitempty"`
+}
+
+type AuthConfig struct {
+	ApiKeys       []ApiKeyConfig `yaml:"api_keys,omitempty"`
+	SessionSecret string         `yaml:"session_secret,omitempty"`
+	SessionTTL    *time.Duration `yaml:"session_ttl,omitempty"`
+}
+
+type ApiKeyConfig struct {
+	Name   string   `yaml:"name"`
+	Key    string   `yaml:"key"`
+	User   string   `yaml:"user"`
+	Scopes []string `yaml:"scopes"`
 }
 
 type MockServerConfig struct {
 	Port int `yaml:"port"`
+	// Seed selects the generated data set, the same seed always yields the same artists and tracks.
+	Seed uint64 `yaml:"seed,omitempty"`
+	// Fixtures is a directory of recorded responses served in place of generated data.
+	Fixtures string `yaml:"fixtures,omitempty"`
+	// Fallback decides how ids without fixture are answered, generate or not_found.
+	Fallback string `yaml:"fallback,omitempty"`
+	// ClientID and ClientSecret are the credentials tokens are issued for, any are accepted if unset.
+	ClientID     string `yaml:"client_id,omitempty"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	// Record forwards requests for objects without fixture to the real Spotify API and saves the responses to
+	// the fixtures directory, from where they are replayed later on.
+	Record *SpotifyConfig `yaml:"record,omitempty"`
+	// Scenario names the entry of Scenarios active on startup, the default scenario if empty.
+	Scenario  string                        `yaml:"scenario,omitempty"`
+	Scenarios map[string]MockScenarioConfig `yaml:"scenarios,omitempty"`
+}
+
+// MockScenarioConfig describes how the mock server misbehaves. Without latency settings responses are delayed
+// by 50ms to 5s.
+type MockScenarioConfig struct {
+	Latency *MockLatencyConfig `yaml:"latency,omitempty"`
+	// TokenExpiresIn overrides the lifetime of issued tokens, one hour by default.
+	TokenExpiresIn *time.Duration `yaml:"token_expires_in,omitempty"`
+	// Faults maps endpoints, token, artist, artists, track, tracks, album, albums or * for all others, to the
+	// faults injected into their responses.
+	Faults map[string]MockFaultsConfig `yaml:"faults,omitempty"`
+}
+
+// MockLatencyConfig delays responses either by a fixed duration, uniformly between min and max, or following the
+// distribution given by its 50th, 90th and 99th percentile.
+type MockLatencyConfig struct {
+	Fixed *time.Duration `yaml:"fixed,omitempty"`
+	Min   time.Duration  `yaml:"min,omitempty"`
+	Max   time.Duration  `yaml:"max,omitempty"`
+	P50   time.Duration  `yaml:"p50,omitempty"`
+	P90   time.Duration  `yaml:"p90,omitempty"`
+	P99   time.Duration  `yaml:"p99,omitempty"`
+}
+
+// MockFaultsConfig holds the probability between 0 and 1 of each fault. At most one fault is injected per
+// response, so the probabilities except NullEntries must not add up to more than 1.
+type MockFaultsConfig struct {
+	InternalError float64 `yaml:"internal_error,omitempty"`
+	BadGateway    float64 `yaml:"bad_gateway,omitempty"`
+	// ExpiredToken answers 401 as Spotify does once a token expired.
+	ExpiredToken float64 `yaml:"expired_token,omitempty"`
+	RateLimited  float64 `yaml:"rate_limited,omitempty"`
+	// RetryAfter is sent with rate limited responses, one second by default.
+	RetryAfter    time.Duration `yaml:"retry_after,omitempty"`
+	MalformedJson float64       `yaml:"malformed_json,omitempty"`
+	// NullEntries is the probability of every single entry of a batch response to be null.
+	NullEntries float64 `yaml:"null_entries,omitempty"`
 }
 
 type SpotifyConfig struct {
@@ -39,30 +173,61 @@ type SpotifyConfig struct {
 }
 
 type DatabaseConfig struct {
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Database string `yaml:"db"`
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	Database    string `yaml:"db"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	AutoMigrate *bool  `yaml:"auto_migrate,omitempty"`
 }
 
 type DiscoverConfig struct {
 	BatchSize     int            `yaml:"batch_size"`
 	RetryInterval *time.Duration `yaml:"retry_interval,omitempty"`
+	MaxQueueAge   *time.Duration `yaml:"max_queue_age,omitempty"`
+}
+
+type TracingConfig struct {
+	Exporter    string   `yaml:"exporter"`
+	Endpoint    string   `yaml:"endpoint,omitempty"`
+	Insecure    bool     `yaml:"insecure,omitempty"`
+	ServiceName string   `yaml:"service_name,omitempty"`
+	SampleRatio *float64 `yaml:"sample_ratio,omitempty"`
 }
 
-func LoadConfig(path string) *Config {
-	f, err := os.Open(path)
+// LoadConfig reads the yaml file at path, expanding ${VAR} references, and layers the SPOTIFY_VIZ_*
+// environment variables and then the path=value overrides on top of it. Defaults are applied to the result,
+// validating it is left to Validate.
+func LoadConfig(path string, overrides ...string) (*Config, error) {
+	raw, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("error opening config file: %v", err)
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var document yaml.Node
+	if err = yaml.Unmarshal(bytes.TrimPrefix(raw, []byte("\ufeff")), &document); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+
+	if err = expandVariables(&document); err != nil {
+		return nil, err
 	}
-	defer f.Close()
 
 	var cfg Config
-	decoder := yaml.NewDecoder(f)
-	if err = decoder.Decode(&cfg); err != nil {
-		log.Fatalf("error decoding config: %v", err)
+	if document.Kind != 0 {
+		if err = document.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("error decoding config: %w", err)
+		}
+	}
+
+	if err = applyEnvOverrides(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err = applyOverrides(&cfg, overrides); err != nil {
+		return nil, err
 	}
 
-	return &cfg
+	cfg.applyDefaults()
+	return &cfg, nil
 }
@@ -0,0 +1,84 @@
+package config
+
+import "time"
+
+const (
+	DefaultZapEnvironment  = "development"
+	DefaultBatchSize       = 50
+	DefaultRetryInterval   = 5 * time.Minute
+	DefaultMaxQueueAge     = time.Hour
+	DefaultDatabaseHost    = "localhost"
+	DefaultDatabasePort    = 5432
+	DefaultAccessLogFormat = "json"
+
+	DefaultLogMaxSizeMB  = 100
+	DefaultLogMaxAgeDays = 30
+	DefaultLogMaxBackups = 10
+)
+
+// applyDefaults fills optional sections and fields left out of the file, so the rest of the backend never
+// has to check them for nil.
+func (c *Config) applyDefaults() {
+	if c.Logging.Zap == nil {
+		zapEnvironment := DefaultZapEnvironment
+		c.Logging.Zap = &zapEnvironment
+	}
+
+	if c.Logging.Rotation == nil {
+		c.Logging.Rotation = &LogRotationConfig{}
+	}
+	if c.Logging.Rotation.MaxSizeMB == 0 {
+		c.Logging.Rotation.MaxSizeMB = DefaultLogMaxSizeMB
+	}
+	if c.Logging.Rotation.MaxAgeDays == 0 {
+		c.Logging.Rotation.MaxAgeDays = DefaultLogMaxAgeDays
+	}
+	if c.Logging.Rotation.MaxBackups == 0 {
+		c.Logging.Rotation.MaxBackups = DefaultLogMaxBackups
+	}
+	if c.Logging.Rotation.Compress == nil {
+		compress := true
+		c.Logging.Rotation.Compress = &compress
+	}
+
+	if c.DiscoverConfig == nil {
+		c.DiscoverConfig = &DiscoverConfig{}
+	}
+	if c.DiscoverConfig.BatchSize == 0 {
+		c.DiscoverConfig.BatchSize = DefaultBatchSize
+	}
+	if c.DiscoverConfig.RetryInterval == nil {
+		retryInterval := DefaultRetryInterval
+		c.DiscoverConfig.RetryInterval = &retryInterval
+	}
+	if c.DiscoverConfig.MaxQueueAge == nil {
+		maxQueueAge := DefaultMaxQueueAge
+		c.DiscoverConfig.MaxQueueAge = &maxQueueAge
+	}
+
+	if c.Server != nil {
+		if c.Server.AccessLog == nil {
+			c.Server.AccessLog = &AccessLogConfig{}
+		}
+		if c.Server.AccessLog.Enabled == nil {
+			enabled := true
+			c.Server.AccessLog.Enabled = &enabled
+		}
+		if c.Server.AccessLog.Format == "" {
+			c.Server.AccessLog.Format = DefaultAccessLogFormat
+		}
+	}
+
+	if c.DatabaseConfig != nil {
+		if c.DatabaseConfig.Host == "" {
+			c.DatabaseConfig.Host = DefaultDatabaseHost
+		}
+		if c.DatabaseConfig.Port == 0 {
+			c.DatabaseConfig.Port = DefaultDatabasePort
+		}
+		if c.DatabaseConfig.AutoMigrate == nil {
+			autoMigrate := true
+			c.DatabaseConfig.AutoMigrate = &autoMigrate
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables overriding config fields. The variable name is the yaml path
+// of the field in upper case joined by underscores, e.g. SPOTIFY_VIZ_SPOTIFY_CLIENT_SECRET for
+// spotify.client_secret. Appending _FILE reads the value from the named file instead, as used for Docker secrets.
+const EnvPrefix = "SPOTIFY_VIZ_"
+
+const fileSuffix = "_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?}`)
+
+// expandVariables replaces ${VAR} and ${VAR:-default} in the scalar values of the parsed yaml, so expanded
+// values are never parsed as yaml themselves and comments are left alone. Variables that are unset and have no
+// default are reported instead of silently becoming empty.
+func expandVariables(node *yaml.Node) error {
+	var missing []string
+	expand := func(match string) string {
+		groups := variablePattern.FindStringSubmatch(match)
+		if value, exists := os.LookupEnv(groups[1]); exists {
+			return value
+		}
+		if strings.Contains(match, ":-") {
+			return groups[3]
+		}
+		missing = append(missing, groups[1])
+		return ""
+	}
+
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode && variablePattern.MatchString(node.Value) {
+			node.Value = variablePattern.ReplaceAllStringFunc(node.Value, expand)
+			// plain scalars are resolved again from the expanded value, so ${PORT} can still fill an int
+			if node.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				node.Tag = ""
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	if len(missing) > 0 {
+		return fmt.Errorf("undefined variables in config: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// applyEnvOverrides sets every field that has a SPOTIFY_VIZ_* variable, or its _FILE variant, set.
+func applyEnvOverrides(cfg *Config) error {
+	var errs []error
+	for _, path := range leafPaths(reflect.TypeOf(*cfg), nil) {
+		name := EnvPrefix + strings.ToUpper(strings.Join(path, "_"))
+
+		value, exists := os.LookupEnv(name)
+		file, fileExists := os.LookupEnv(name + fileSuffix)
+		switch {
+		case exists && fileExists:
+			errs = append(errs, fmt.Errorf("%s and %s are both set", name, name+fileSuffix))
+			continue
+		case fileExists:
+			content, err := os.ReadFile(file)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name+fileSuffix, err))
+				continue
+			}
+			value = strings.TrimRight(string(content), "\r\n")
+		case !exists:
+			continue
+		}
+
+		if err := setPath(reflect.ValueOf(cfg).Elem(), path, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyOverrides sets fields from path=value pairs, e.g. discover.batch_size=20 as passed by the -set flag.
+func applyOverrides(cfg *Config, overrides []string) error {
+	var errs []error
+	for _, override := range overrides {
+		path, value, found := strings.Cut(override, "=")
+		if !found || path == "" {
+			errs = append(errs, fmt.Errorf("override %q is not of the form path=value", override))
+			continue
+		}
+
+		if err := setPath(reflect.ValueOf(cfg).Elem(), strings.Split(path, "."), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// leafPaths lists the yaml paths of all scalar fields. Maps and lists of sections, like the api keys, are not
+// addressable this way and are left to the yaml file.
+func leafPaths(t reflect.Type, prefix []string) [][]string {
+	var paths [][]string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := yamlName(field)
+		if !ok {
+			continue
+		}
+
+		path := append(append([]string{}, prefix...), name)
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		switch {
+		case fieldType.Kind() == reflect.Struct:
+			paths = append(paths, leafPaths(fieldType, path)...)
+		case fieldType.Kind() == reflect.Map,
+			fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() != reflect.String:
+			continue
+		default:
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// setPath walks the yaml path from v, allocating missing sections, and parses raw into the field it ends at.
+func setPath(v reflect.Value, path []string, raw string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if len(path) == 0 {
+		return setValue(v, raw)
+	}
+
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not a section", path[0])
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		if name, ok := yamlName(v.Type().Field(i)); ok && name == path[0] {
+			return setPath(v.Field(i), path[1:], raw)
+		}
+	}
+
+	return fmt.Errorf("unknown field %s", path[0])
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(duration))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(parsed)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("lists of %s can't be overridden", v.Type().Elem())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("fields of type %s can't be overridden", v.Type())
+	}
+
+	return nil
+}
+
+// yamlName returns the key yaml.v3 decodes the field from, the lower cased field name if untagged.
+func yamlName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(field.Name), true
+	default:
+		return name, true
+	}
+}
@@ -0,0 +1,347 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxBatchSize = 50
+
+var (
+	zapEnvironments  = []string{"development", "production"}
+	logLevels        = []string{"debug", "info", "warn", "error"}
+	logComponents    = []string{"api", "discovery", "spotifyapi"}
+	accessLogFormats = []string{"json", "common", "combined"}
+	exporters        = []string{"", "none", "stdout", "otlp"}
+	mockFallbacks    = []string{"", "generate", "not_found"}
+	mockEndpoints    = []string{"*", "token", "artist", "artists", "track", "tracks", "album", "albums"}
+)
+
+// Problem is a single invalid field, addressed by its yaml path.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+// ValidationError reports every problem found in a config at once.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid config:")
+	for _, problem := range e.Problems {
+		b.WriteString(fmt.Sprintf("\n  %s: %s", problem.Path, problem.Message))
+	}
+	return b.String()
+}
+
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) add(path string, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path string, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(path, "is required")
+	}
+}
+
+func (v *validator) port(path string, port int) {
+	if port < 1 || port > 65535 {
+		v.add(path, "must be a port between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) positiveDuration(path string, duration *time.Duration) {
+	if duration != nil && *duration <= 0 {
+		v.add(path, "must be a positive duration, got %s", *duration)
+	}
+}
+
+func (v *validator) httpUrl(path string, value string) {
+	if value == "" {
+		v.add(path, "is required")
+		return
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.add(path, "must be an absolute http(s) url, got %q", value)
+	}
+}
+
+func (v *validator) oneOf(path string, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		v.add(path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+	}
+}
+
+// Deprecations lists the settings that are still accepted but ignored, so they can be logged once logging is
+// set up.
+func (c *Config) Deprecations() []string {
+	var deprecations []string
+	if c.Logging.ApiFile != nil {
+		deprecations = append(deprecations, "logging.api_file is ignored, it was replaced by server.access_log.file")
+	}
+	return deprecations
+}
+
+// Validate checks all present sections and that the given top level sections, e.g. "server" or "database",
+// exist. All problems are returned together as a *ValidationError.
+func (c *Config) Validate(requiredSections ...string) error {
+	v := &validator{}
+
+	present := map[string]bool{
+		"server":      c.Server != nil,
+		"mock_server": c.MockServerConfig != nil,
+		"spotify":     c.SpotifyConfig != nil,
+		"database":    c.DatabaseConfig != nil,
+		"discover":    c.DiscoverConfig != nil,
+		"tracing":     c.TracingConfig != nil,
+	}
+	for _, section := range requiredSections {
+		if !present[section] {
+			v.add(section, "section is required")
+		}
+	}
+
+	c.Logging.validate(v)
+
+	if c.Server != nil {
+		c.Server.validate(v)
+	}
+
+	if c.MockServerConfig != nil {
+		c.MockServerConfig.validate(v)
+	}
+
+	if c.SpotifyConfig != nil {
+		c.SpotifyConfig.validate(v, "spotify")
+	}
+
+	if c.DatabaseConfig != nil {
+		v.required("database.username", c.DatabaseConfig.Username)
+		v.required("database.db", c.DatabaseConfig.Database)
+		v.required("database.host", c.DatabaseConfig.Host)
+		v.port("database.port", c.DatabaseConfig.Port)
+	}
+
+	if c.DiscoverConfig != nil {
+		if batchSize := c.DiscoverConfig.BatchSize; batchSize < 1 || batchSize > maxBatchSize {
+			v.add("discover.batch_size", "must be between 1 and %d, got %d", maxBatchSize, batchSize)
+		}
+		v.positiveDuration("discover.retry_interval", c.DiscoverConfig.RetryInterval)
+		v.positiveDuration("discover.max_queue_age", c.DiscoverConfig.MaxQueueAge)
+	}
+
+	if c.TracingConfig != nil {
+		v.oneOf("tracing.exporter", c.TracingConfig.Exporter, exporters)
+		if ratio := c.TracingConfig.SampleRatio; ratio != nil && (*ratio < 0 || *ratio > 1) {
+			v.add("tracing.sample_ratio", "must be between 0 and 1, got %g", *ratio)
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+func (l *LoggingConfig) validate(v *validator) {
+	if l.Zap != nil {
+		v.oneOf("logging.zap", *l.Zap, zapEnvironments)
+	}
+	if l.Level != nil {
+		v.oneOf("logging.level", *l.Level, logLevels)
+	}
+
+	for _, component := range slices.Sorted(maps.Keys(l.Components)) {
+		v.oneOf("logging.components", component, logComponents)
+		v.oneOf("logging.components."+component, l.Components[component], logLevels)
+	}
+
+	if l.Sinks != nil {
+		sinks := map[string]string{"console": l.Sinks.Console, "file": l.Sinks.File, "json": l.Sinks.Json}
+		for _, sink := range []string{"console", "file", "json"} {
+			if sinks[sink] != "" {
+				v.oneOf("logging.sinks."+sink, sinks[sink], logLevels)
+			}
+		}
+	}
+
+	if l.Rotation != nil {
+		if l.Rotation.MaxSizeMB < 0 {
+			v.add("logging.rotation.max_size_mb", "must not be negative, got %d", l.Rotation.MaxSizeMB)
+		}
+		if l.Rotation.MaxAgeDays < 0 {
+			v.add("logging.rotation.max_age_days", "must not be negative, got %d", l.Rotation.MaxAgeDays)
+		}
+		if l.Rotation.MaxBackups < 0 {
+			v.add("logging.rotation.max_backups", "must not be negative, got %d", l.Rotation.MaxBackups)
+		}
+	}
+}
+
+func (s *ApiServerConfig) validate(v *validator) {
+	v.port("server.port", s.Port)
+
+	if s.Auth != nil && s.DevMode {
+		v.add("server.dev_mode", "can't be combined with server.auth, the X-User header is only read without auth")
+	}
+
+	if s.Auth != nil {
+		v.positiveDuration("server.auth.session_ttl", s.Auth.SessionTTL)
+		for i, apiKey := range s.Auth.ApiKeys {
+			path := fmt.Sprintf("server.auth.api_keys[%d]", i)
+			v.required(path+".name", apiKey.Name)
+			v.required(path+".key", apiKey.Key)
+			if len(apiKey.Scopes) == 0 {
+				v.add(path+".scopes", "must grant at least one scope")
+			}
+		}
+	}
+
+	if s.Cors != nil && s.Cors.MaxAge != nil && *s.Cors.MaxAge < 0 {
+		v.add("server.cors.max_age", "must not be negative, got %s", *s.Cors.MaxAge)
+	}
+
+	if s.AccessLog != nil && s.AccessLog.Format != "" {
+		v.oneOf("server.access_log.format", s.AccessLog.Format, accessLogFormats)
+	}
+
+	for i, proxy := range s.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err = netip.ParseAddr(proxy); err != nil {
+				v.add(fmt.Sprintf("server.trusted_proxies[%d]", i), "must be an IP or CIDR, got %q", proxy)
+			}
+		}
+	}
+
+	if s.Limits != nil {
+		if s.Limits.RequestsPerSecond < 0 {
+			v.add("server.limits.requests_per_second", "must not be negative, got %g", s.Limits.RequestsPerSecond)
+		}
+		if s.Limits.Burst < 0 {
+			v.add("server.limits.burst", "must not be negative, got %d", s.Limits.Burst)
+		}
+		if s.Limits.MaxBodyBytes < 0 {
+			v.add("server.limits.max_body_bytes", "must not be negative, got %d", s.Limits.MaxBodyBytes)
+		}
+		if s.Limits.MaxArtistsPerRequest < 0 {
+			v.add("server.limits.max_artists_per_request", "must not be negative, got %d", s.Limits.MaxArtistsPerRequest)
+		}
+	}
+}
+
+func (m *MockServerConfig) validate(v *validator) {
+	v.port("mock_server.port", m.Port)
+	v.oneOf("mock_server.fallback", m.Fallback, mockFallbacks)
+	if m.ClientID != "" {
+		v.required("mock_server.client_secret", m.ClientSecret)
+	}
+	if m.Record != nil {
+		m.Record.validate(v, "mock_server.record")
+		if m.Fixtures == "" {
+			v.add("mock_server.fixtures", "is required to record")
+		}
+	}
+
+	if _, exists := m.Scenarios[m.Scenario]; m.Scenario != "" && !exists {
+		v.add("mock_server.scenario", "must name one of mock_server.scenarios, got %q", m.Scenario)
+	}
+	for _, name := range slices.Sorted(maps.Keys(m.Scenarios)) {
+		m.Scenarios[name].validate(v, "mock_server.scenarios."+name)
+	}
+}
+
+// Validate checks a scenario on its own, e.g. one received at runtime. Problems are addressed relative to the
+// scenario.
+func (s MockScenarioConfig) Validate() error {
+	v := &validator{}
+	s.validate(v, "scenario")
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+func (s MockScenarioConfig) validate(v *validator, path string) {
+	v.positiveDuration(path+".token_expires_in", s.TokenExpiresIn)
+
+	if latency := s.Latency; latency != nil {
+		modes := 0
+		if latency.Fixed != nil {
+			modes++
+			if *latency.Fixed < 0 {
+				v.add(path+".latency.fixed", "must not be negative, got %s", *latency.Fixed)
+			}
+		}
+		if latency.Min != 0 || latency.Max != 0 {
+			modes++
+			if latency.Min < 0 || latency.Max < latency.Min {
+				v.add(path+".latency", "min must not be negative nor exceed max, got %s and %s", latency.Min, latency.Max)
+			}
+		}
+		if latency.P50 != 0 || latency.P90 != 0 || latency.P99 != 0 {
+			modes++
+			if latency.P50 < 0 || latency.P90 < latency.P50 || latency.P99 < latency.P90 {
+				v.add(path+".latency", "percentiles must not be negative and must ascend, got %s, %s and %s",
+					latency.P50, latency.P90, latency.P99)
+			}
+		}
+		if modes > 1 {
+			v.add(path+".latency", "only one of fixed, min and max or the percentiles may be set")
+		}
+	}
+
+	for _, endpoint := range slices.Sorted(maps.Keys(s.Faults)) {
+		faults := s.Faults[endpoint]
+		faultsPath := path + ".faults." + endpoint
+		v.oneOf(faultsPath, endpoint, mockEndpoints)
+
+		probabilities := map[string]float64{
+			"internal_error": faults.InternalError,
+			"bad_gateway":    faults.BadGateway,
+			"expired_token":  faults.ExpiredToken,
+			"rate_limited":   faults.RateLimited,
+			"malformed_json": faults.MalformedJson,
+			"null_entries":   faults.NullEntries,
+		}
+		for _, name := range slices.Sorted(maps.Keys(probabilities)) {
+			if p := probabilities[name]; p < 0 || p > 1 {
+				v.add(faultsPath+"."+name, "must be between 0 and 1, got %g", p)
+			}
+		}
+		total := faults.InternalError + faults.BadGateway + faults.ExpiredToken + faults.RateLimited + faults.MalformedJson
+		if total > 1 {
+			v.add(faultsPath, "fault probabilities must not add up to more than 1, got %g", total)
+		}
+		if faults.RetryAfter < 0 {
+			v.add(faultsPath+".retry_after", "must not be negative, got %s", faults.RetryAfter)
+		}
+	}
+}
+
+// validate checks the Spotify settings found at path, spotify or mock_server.record.
+func (s *SpotifyConfig) validate(v *validator, path string) {
+	v.httpUrl(path+".account_url", s.AccountUrl)
+	v.httpUrl(path+".base_api_url", s.BaseApiUrl)
+	v.required(path+".client_id", s.ClientID)
+	v.required(path+".client_secret", s.ClientSecret)
+
+	if s.RetryCount != nil && *s.RetryCount < 0 {
+		v.add(path+".retry_count", "must not be negative, got %d", *s.RetryCount)
+	}
+	v.positiveDuration(path+".retry_wait_time", s.RetryWaitTime)
+	v.positiveDuration(path+".time_out", s.TimeOut)
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Watcher reloads the config file when its modification time changes or Reload is called. Only configs that
+// load and validate are passed to onChange, otherwise onError is called and the previous config stays active.
+type Watcher struct {
+	path             string
+	overrides        []string
+	requiredSections []string
+	onChange         func(previous, updated *Config)
+	onError          func(err error)
+
+	lock    sync.Mutex
+	current *Config
+	modTime time.Time
+}
+
+func NewWatcher(path string, overrides []string, requiredSections []string, current *Config, onChange func(previous, updated *Config), onError func(err error)) *Watcher {
+	watcher := &Watcher{
+		path:             path,
+		overrides:        overrides,
+		requiredSections: requiredSections,
+		onChange:         onChange,
+		onError:          onError,
+		current:          current,
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		watcher.modTime = info.ModTime()
+	}
+	return watcher
+}
+
+// Run polls the file for changes until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(w.path)
+			if err != nil {
+				w.onError(err)
+				continue
+			}
+
+			w.lock.Lock()
+			changed := !info.ModTime().Equal(w.modTime)
+			w.modTime = info.ModTime()
+			w.lock.Unlock()
+
+			if changed {
+				w.Reload()
+			}
+		}
+	}
+}
+
+// Reload reads and validates the file, calling onChange if it differs from the active config.
+func (w *Watcher) Reload() {
+	updated, err := LoadConfig(w.path, w.overrides...)
+	if err == nil {
+		err = updated.Validate(w.requiredSections...)
+	}
+	if err != nil {
+		w.onError(err)
+		return
+	}
+
+	w.lock.Lock()
+	previous := w.current
+	if len(Diff(previous, updated)) == 0 {
+		w.lock.Unlock()
+		return
+	}
+	w.current = updated
+	w.lock.Unlock()
+
+	w.onChange(previous, updated)
+}
+
+// Diff returns the yaml paths of all fields that differ between the configs. A section added or removed as a
+// whole is reported by its own path.
+func Diff(previous, updated *Config) []string {
+	return diffValues(reflect.ValueOf(*previous), reflect.ValueOf(*updated), "")
+}
+
+func diffValues(previous, updated reflect.Value, path string) []string {
+	if previous.Kind() == reflect.Pointer {
+		if previous.IsNil() || updated.IsNil() {
+			if previous.IsNil() != updated.IsNil() {
+				return []string{path}
+			}
+			return nil
+		}
+		return diffValues(previous.Elem(), updated.Elem(), path)
+	}
+
+	if previous.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(previous.Interface(), updated.Interface()) {
+			return []string{path}
+		}
+		return nil
+	}
+
+	var changed []string
+	for i := 0; i < previous.NumField(); i++ {
+		name, ok := yamlName(previous.Type().Field(i))
+		if !ok {
+			continue
+		}
+
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		changed = append(changed, diffValues(previous.Field(i), updated.Field(i), fieldPath)...)
+	}
+	return changed
+}
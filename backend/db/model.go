@@ -31,4 +31,28 @@ type ArtistDiscovery struct {
 	gorm.Model
 	ArtistName string
 	TrackUri   string `gorm:"index;unique"`
+	UserID     uint   `gorm:"index"`
+	ImportID   uint   `gorm:"index"`
+	RequestID  string `gorm:"index"`
+}
+
+type User struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex"`
+}
+
+type Import struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	User       User
+	TrackCount int
+	RequestID  string
+}
+
+type UserTrack struct {
+	UserID     uint   `gorm:"primarykey"`
+	TrackUri   string `gorm:"primarykey"`
+	ImportID   uint   `gorm:"index"`
+	ArtistName string
+	CreatedAt  time.Time
 }
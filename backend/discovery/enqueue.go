@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"backend/db"
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// insertBatchSize keeps large imports below the bind parameter limit of postgres.
+const insertBatchSize = 1000
+
+// QueuedTrack is a track of a user's listening history to be discovered.
+type QueuedTrack struct {
+	ArtistName string
+	TrackUri   string
+}
+
+// Enqueue records an import of the given tracks for the user and queues them for discovery in one transaction.
+// Tracks the user already imported or that are already queued are skipped.
+func Enqueue(ctx context.Context, conn *gorm.DB, userID uint, requestId string, tracks []QueuedTrack) (*db.Import, error) {
+	dbImport := db.Import{
+		UserID:     userID,
+		TrackCount: len(tracks),
+		RequestID:  requestId,
+	}
+
+	err := conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if res := tx.Create(&dbImport); res.Error != nil {
+			return res.Error
+		}
+
+		var userTracks []db.UserTrack
+		var dbDiscovery []db.ArtistDiscovery
+		for _, track := range tracks {
+			userTracks = append(userTracks, db.UserTrack{
+				UserID:     userID,
+				TrackUri:   track.TrackUri,
+				ImportID:   dbImport.ID,
+				ArtistName: track.ArtistName,
+			})
+			dbDiscovery = append(dbDiscovery, db.ArtistDiscovery{
+				ArtistName: track.ArtistName,
+				TrackUri:   track.TrackUri,
+				UserID:     userID,
+				ImportID:   dbImport.ID,
+				RequestID:  requestId,
+			})
+		}
+
+		if len(tracks) == 0 {
+			return nil
+		}
+
+		if res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&userTracks, insertBatchSize); res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&dbDiscovery, insertBatchSize).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbImport, nil
+}
+
+// Notify wakes up the discovery worker listening on the discovery channel.
+func Notify(ctx context.Context, conn *gorm.DB) error {
+	return conn.WithContext(ctx).Exec("NOTIFY " + NotifyChannel).Error
+}
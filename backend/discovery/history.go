@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const trackUriPrefix = "spotify:track:"
+
+// StreamingHistoryEntry is the subset of an entry of a Spotify extended streaming history export
+// (Streaming_History_Audio_*.json) needed for discovery.
+type StreamingHistoryEntry struct {
+	TrackUri   *string `json:"spotify_track_uri"`
+	ArtistName *string `json:"master_metadata_album_artist_name"`
+}
+
+// ReadStreamingHistory parses a streaming history export into one track per artist, the first one played, like
+// the frontend does. Entries without a track, like podcast episodes, and entries with invalid track ids are skipped
+// and counted.
+func ReadStreamingHistory(r io.Reader) ([]QueuedTrack, int, error) {
+	var entries []StreamingHistoryEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("invalid streaming history: %w", err)
+	}
+
+	skipped := 0
+	seen := make(map[string]struct{}, len(entries))
+	tracks := make([]QueuedTrack, 0, len(entries))
+	for _, entry := range entries {
+		if entry.TrackUri == nil || entry.ArtistName == nil {
+			skipped++
+			continue
+		}
+
+		trackId := strings.TrimPrefix(*entry.TrackUri, trackUriPrefix)
+		if ValidateTrackId(trackId) != nil {
+			skipped++
+			continue
+		}
+
+		if _, exists := seen[*entry.ArtistName]; exists {
+			continue
+		}
+		seen[*entry.ArtistName] = struct{}{}
+
+		tracks = append(tracks, QueuedTrack{ArtistName: *entry.ArtistName, TrackUri: trackId})
+	}
+
+	return tracks, skipped, nil
+}
@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"time"
+)
+
+// NotifyChannel is the postgres channel Notify announces new discoveries on.
+const NotifyChannel = "discovery"
+
+const listenerPingInterval = 90 * time.Second
+
+// ListenerStatus is told about the connection of the listener, health.ListenerState implements it.
+type ListenerStatus interface {
+	SetConnected()
+	SetError(err error)
+}
+
+// RunLoop runs worker once and then whenever a notification arrives or retryInterval passes, until ctx is
+// done. The listener is created by newListener and closed on return, so a new leader term starts a new one.
+func RunLoop(ctx context.Context, worker *DiscoverWorker, newListener func() *pq.Listener, status ListenerStatus, retryInterval func() time.Duration, logger *zap.Logger) {
+	listener := newListener()
+	defer func() {
+		if closeErr := listener.Close(); closeErr != nil {
+			logger.Warn("Listener close error", zap.Error(closeErr))
+		}
+	}()
+
+	listenErr := listener.Listen(NotifyChannel)
+	if listenErr != nil {
+		status.SetError(listenErr)
+		logger.Error("Listener init error", zap.Error(listenErr))
+	} else {
+		status.SetConnected()
+	}
+
+	worker.Run(ctx)
+
+	timer := time.NewTicker(retryInterval())
+	defer func() { timer.Stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-listener.Notify:
+			logger.Info("Got new notification", zap.Any("notification", notification))
+			worker.Run(ctx)
+		case <-time.After(listenerPingInterval):
+			go func() {
+				if pingErr := listener.Ping(); pingErr != nil {
+					status.SetError(pingErr)
+					logger.Warn("Listener ping failed", zap.Error(pingErr))
+				} else {
+					status.SetConnected()
+				}
+			}()
+		case <-timer.C:
+			timer.Stop()
+			worker.Run(ctx)
+			timer = time.NewTicker(retryInterval())
+		}
+	}
+}
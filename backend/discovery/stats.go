@@ -0,0 +1,56 @@
+package discovery
+
+import (
+	"backend/db"
+	"context"
+	"gorm.io/gorm"
+)
+
+type QueueStats struct {
+	RemainingArtistsCount  int64
+	AlreadyDiscoveredCount int64
+}
+
+type UserStats struct {
+	ImportsCount          int64
+	TracksCount           int64
+	DiscoveredTracksCount int64
+	RemainingTracksCount  int64
+}
+
+// GetQueueStats counts the discovered artists and the queue entries still waiting for discovery.
+func GetQueueStats(ctx context.Context, conn *gorm.DB) (QueueStats, error) {
+	conn = conn.WithContext(ctx)
+
+	var stats QueueStats
+	if res := conn.Model(&db.Artist{}).Count(&stats.AlreadyDiscoveredCount); res.Error != nil {
+		return stats, res.Error
+	}
+
+	res := conn.Model(&db.ArtistDiscovery{}).Count(&stats.RemainingArtistsCount)
+	return stats, res.Error
+}
+
+// GetUserStats counts the imports and tracks of a user and how many of those tracks are discovered yet.
+func GetUserStats(ctx context.Context, conn *gorm.DB, userID uint) (UserStats, error) {
+	conn = conn.WithContext(ctx)
+	userTracks := func() *gorm.DB {
+		return conn.Model(&db.UserTrack{}).Where("user_id = ?", userID)
+	}
+
+	var stats UserStats
+	queries := []*gorm.DB{
+		conn.Model(&db.Import{}).Where("user_id = ?", userID).Count(&stats.ImportsCount),
+		userTracks().Count(&stats.TracksCount),
+		userTracks().Where("track_uri IN (?)", conn.Model(&db.Track{}).Select("id")).Count(&stats.DiscoveredTracksCount),
+		userTracks().Where("track_uri IN (?)", conn.Model(&db.ArtistDiscovery{}).Select("track_uri")).Count(&stats.RemainingTracksCount),
+	}
+
+	for _, query := range queries {
+		if query.Error != nil {
+			return stats, query.Error
+		}
+	}
+
+	return stats, nil
+}
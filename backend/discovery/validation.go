@@ -0,0 +1,19 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var ErrInvalidTrackId = errors.New("invalid spotify track id")
+
+var trackIdPattern = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// ValidateTrackId checks that the id is a base62 Spotify track id, as the tracks endpoint expects it.
+func ValidateTrackId(id string) error {
+	if !trackIdPattern.MatchString(id) {
+		return fmt.Errorf("%w: %q must be 22 base62 characters", ErrInvalidTrackId, id)
+	}
+	return nil
+}
@@ -2,51 +2,83 @@ package discovery
 
 import (
 	"backend/db"
+	"backend/metrics"
+	"backend/requestid"
 	"backend/spotifyapi"
+	"backend/telemetry"
+	"context"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var tracer = telemetry.Tracer("backend/discovery")
+
+// LeaderLockKey is the advisory lock electing the one process running the worker among all replicas.
+const LeaderLockKey = 7_352_002
+
 type DiscoverWorker struct {
-	batchSize     int
+	batchSize     atomic.Int64
 	spotifyClient spotifyapi.SpotifyClient
 	db            *gorm.DB
 	logger        *zap.Logger
 
 	lock      sync.Mutex
-	isWorking bool
+	isWorking atomic.Bool
+	heartbeat atomic.Int64
+	lastRun   atomic.Int64
 }
 
 func NewDiscoverWorker(batchSize int, spotifyClient spotifyapi.SpotifyClient, db *gorm.DB, logger *zap.Logger) *DiscoverWorker {
-	return &DiscoverWorker{
-		batchSize:     batchSize,
+	worker := &DiscoverWorker{
 		spotifyClient: spotifyClient,
 		db:            db,
 		logger:        logger,
 	}
+	worker.SetBatchSize(batchSize)
+	return worker
 }
 
-func (worker *DiscoverWorker) Run() {
+// SetBatchSize changes the number of discoveries processed per batch, taking effect with the next run.
+func (worker *DiscoverWorker) SetBatchSize(batchSize int) {
+	worker.batchSize.Store(int64(batchSize))
+}
+
+func (worker *DiscoverWorker) BatchSize() int {
+	return int(worker.batchSize.Load())
+}
+
+// Run processes the discovery queue in batches until it is empty. A cancelled ctx stops it between batches.
+func (worker *DiscoverWorker) Run(ctx context.Context) {
 	worker.logger.Info("Starting DiscoverWorker...")
 
-	if worker.isWorking {
+	worker.beat()
+	if worker.isWorking.Load() {
 		worker.logger.Info("DiscoverWorker already running, skipping...")
 		return
 	}
 
 	worker.lock.Lock()
-	worker.isWorking = true
+	worker.isWorking.Store(true)
+	metrics.DiscoveryWorkerRunning.Set(1)
 	defer func() {
-		worker.isWorking = false
+		worker.isWorking.Store(false)
+		metrics.DiscoveryWorkerRunning.Set(0)
+		metrics.DiscoveryLastRun.SetToCurrentTime()
+		worker.lastRun.Store(time.Now().UnixNano())
 		worker.lock.Unlock()
 	}()
 
 	var count int64
-	countRes := worker.db.Model(&db.ArtistDiscovery{}).Count(&count)
+	countRes := worker.db.WithContext(ctx).Model(&db.ArtistDiscovery{}).Count(&count)
 
 	if countRes.Error != nil {
 		worker.logger.Error(countRes.Error.Error())
@@ -58,12 +90,14 @@ func (worker *DiscoverWorker) Run() {
 		return
 	}
 
-	amountOfProccesses := count / int64(worker.batchSize)
-	if count%int64(worker.batchSize) != 0 {
+	// read once, a reload during the run must not change the size of the batches and their Spotify requests
+	batchSize := worker.BatchSize()
+	amountOfProccesses := count / int64(batchSize)
+	if count%int64(batchSize) != 0 {
 		amountOfProccesses++
 	}
 
-	loginErr := worker.spotifyClient.Login()
+	loginErr := worker.spotifyClient.Login(ctx)
 	if loginErr != nil {
 		worker.logger.Error(
 			"Failed to login spotify",
@@ -73,66 +107,127 @@ func (worker *DiscoverWorker) Run() {
 	}
 
 	for i := 0; i < int(amountOfProccesses); i++ {
-		err := worker.db.Transaction(func(tx *gorm.DB) error {
-			var discoveries []db.ArtistDiscovery
-			res := tx.Limit(worker.batchSize).Find(&discoveries)
-			if res.Error != nil {
-				worker.logger.Error("error finding artist discoveries", zap.Error(res.Error))
-				return res.Error
-			}
+		if ctx.Err() != nil {
+			worker.logger.Info("DiscoverWorker stopped", zap.Error(ctx.Err()))
+			return
+		}
 
-			if len(discoveries) == 0 {
-				worker.logger.Info("No discoveries found. Nothing to do.")
-				return nil
-			}
+		err := worker.processBatch(ctx, i, batchSize)
+		worker.beat()
+		if err != nil {
+			metrics.DiscoveryBatches.WithLabelValues("error").Inc()
+			worker.logger.Error("Error while discovering artists", zap.Error(err))
+			return
+		}
+		metrics.DiscoveryBatches.WithLabelValues("success").Inc()
+	}
+}
 
-			foundTracks, err := worker.discoverTracks(discoveries)
-			if err != nil {
-				return err
-			}
+// LastHeartbeat returns when the worker was last invoked or finished a batch.
+func (worker *DiscoverWorker) LastHeartbeat() time.Time {
+	nanos := worker.heartbeat.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
 
-			dbTracks, artistIds := worker.transformTracksAndExtractArtistIds(foundTracks)
-			filteredIds, err := worker.filterForExistingArtists(artistIds, tx)
+// LastRun returns when the worker last finished a run, whether it succeeded or not.
+func (worker *DiscoverWorker) LastRun() time.Time {
+	nanos := worker.lastRun.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
 
-			if err != nil {
-				return err
-			}
+func (worker *DiscoverWorker) IsWorking() bool {
+	return worker.isWorking.Load()
+}
 
-			artistProcessEr := worker.processArtistIds(filteredIds, tx)
-			if artistProcessEr != nil {
-				return artistProcessEr
-			}
+func (worker *DiscoverWorker) beat() {
+	worker.heartbeat.Store(time.Now().UnixNano())
+}
 
-			res = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbTracks)
-			if res.Error != nil {
-				return res.Error
-			}
+func (worker *DiscoverWorker) processBatch(ctx context.Context, batch int, batchSize int) (err error) {
+	ctx, span := tracer.Start(ctx, "discovery.batch", trace.WithAttributes(
+		attribute.Int("discovery.batch", batch),
+		attribute.Int("discovery.batch_size", batchSize),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return worker.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The rows stay locked until the transaction ends, so a stale leader still running a batch can't pick
+		// the same discoveries and skips to the next unlocked ones instead.
+		var discoveries []db.ArtistDiscovery
+		res := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Limit(batchSize).Find(&discoveries)
+		if res.Error != nil {
+			worker.logger.Error("error finding artist discoveries", zap.Error(res.Error))
+			return res.Error
+		}
 
-			res = tx.Delete(&discoveries)
-			if res.Error != nil {
-				worker.logger.Error("Error during db action", zap.Error(res.Error))
-				return res.Error
-			}
+		if len(discoveries) == 0 {
+			worker.logger.Info("No discoveries found. Nothing to do.")
 			return nil
-		})
+		}
 
+		ctx, logger := worker.batchContext(ctx, discoveries)
+		span.SetAttributes(attribute.Int("discovery.discoveries", len(discoveries)))
+
+		foundTracks, err := worker.discoverTracks(ctx, logger, discoveries)
 		if err != nil {
-			worker.logger.Error("Error while discovering artists", zap.Error(err))
-			return
+			return err
+		}
+
+		dbTracks, artistIds := worker.transformTracksAndExtractArtistIds(logger, foundTracks)
+		filteredIds, err := worker.filterForExistingArtists(ctx, logger, artistIds, tx)
+
+		if err != nil {
+			return err
+		}
+
+		artistProcessEr := worker.processArtistIds(ctx, logger, filteredIds, batchSize, tx)
+		if artistProcessEr != nil {
+			return artistProcessEr
+		}
+
+		return worker.persistTracks(ctx, logger, dbTracks, discoveries, tx)
+	})
+}
+
+func (worker *DiscoverWorker) persistTracks(ctx context.Context, logger *zap.Logger, dbTracks []db.Track, discoveries []db.ArtistDiscovery, tx *gorm.DB) (err error) {
+	ctx, span := tracer.Start(ctx, "discovery.persistTracks", trace.WithAttributes(
+		attribute.Int("discovery.tracks", len(dbTracks)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	// gorm rejects empty inserts, all tracks may be unknown to Spotify
+	if len(dbTracks) > 0 {
+		res := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&dbTracks)
+		if res.Error != nil {
+			return res.Error
 		}
 	}
+
+	res := tx.WithContext(ctx).Delete(&discoveries)
+	if res.Error != nil {
+		logger.Error("Error during db action", zap.Error(res.Error))
+		return res.Error
+	}
+	return nil
 }
 
-func (worker *DiscoverWorker) processArtistIds(ids []string, tx *gorm.DB) error {
+func (worker *DiscoverWorker) processArtistIds(ctx context.Context, logger *zap.Logger, ids []string, batchSize int, tx *gorm.DB) error {
 	var dbArtists []db.Artist
 	var idsToRequest []string
 	for _, artistId := range ids {
 		idsToRequest = append(idsToRequest, artistId)
-		if len(idsToRequest) == worker.batchSize {
-			worker.logger.Info("Batch Size reached, sending request for artists")
-			found, artistErr := worker.persistArtistsForIds(idsToRequest)
+		if len(idsToRequest) >= batchSize {
+			logger.Info("Batch Size reached, sending request for artists")
+			found, artistErr := worker.persistArtistsForIds(ctx, logger, idsToRequest)
 			if artistErr != nil {
-				worker.logger.Error("Error while persisting artists", zap.Error(artistErr))
+				logger.Error("Error while persisting artists", zap.Error(artistErr))
 				return artistErr
 			}
 			dbArtists = append(dbArtists, found...)
@@ -140,33 +235,50 @@ func (worker *DiscoverWorker) processArtistIds(ids []string, tx *gorm.DB) error
 		}
 	}
 
-	worker.logger.Info("Requesting remaining artists...")
+	logger.Info("Requesting remaining artists...")
 	if len(idsToRequest) > 0 {
-		found, artistErr := worker.persistArtistsForIds(idsToRequest)
+		found, artistErr := worker.persistArtistsForIds(ctx, logger, idsToRequest)
 		if artistErr != nil {
 			return artistErr
 		}
 		dbArtists = append(dbArtists, found...)
 	}
 
-	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbArtists)
+	// gorm rejects empty inserts, all artists may be known already
+	if len(dbArtists) == 0 {
+		return nil
+	}
+
+	persistCtx, span := tracer.Start(ctx, "discovery.persistArtists", trace.WithAttributes(
+		attribute.Int("discovery.artists", len(dbArtists)),
+	))
+	res := tx.WithContext(persistCtx).Clauses(clause.OnConflict{DoNothing: true}).Create(&dbArtists)
+	endSpan(span, res.Error)
 	if res.Error != nil {
-		worker.logger.Error("Error during db action", zap.Error(res.Error))
+		logger.Error("Error during db action", zap.Error(res.Error))
 		return res.Error
 	}
 
 	return nil
 }
 
-func (worker *DiscoverWorker) persistArtistsForIds(ids []string) ([]db.Artist, error) {
-	foundArtists, artistsErr := worker.spotifyClient.GetArtists(ids)
+func (worker *DiscoverWorker) persistArtistsForIds(ctx context.Context, logger *zap.Logger, ids []string) ([]db.Artist, error) {
+	ctx, span := tracer.Start(ctx, "discovery.GetArtists", trace.WithAttributes(
+		attribute.Int("discovery.artist_ids", len(ids)),
+	))
+	foundArtists, artistsErr := worker.spotifyClient.GetArtists(ctx, ids)
+	endSpan(span, artistsErr)
 	if artistsErr != nil {
-		worker.logger.Error("Error while fetching artists", zap.Error(artistsErr))
+		logger.Error("Error while fetching artists", zap.Error(artistsErr))
 		return nil, artistsErr
 	}
 
 	var dbArtists []db.Artist
 	for _, artist := range foundArtists {
+		// Spotify answers unknown ids with null
+		if artist.Id == "" {
+			continue
+		}
 		dbArtists = append(dbArtists, db.Artist{
 			BaseSpotifyModel: db.BaseSpotifyModel{
 				ID: artist.Id,
@@ -180,30 +292,40 @@ func (worker *DiscoverWorker) persistArtistsForIds(ids []string) ([]db.Artist, e
 	return dbArtists, nil
 }
 
-func (worker *DiscoverWorker) discoverTracks(discoveries []db.ArtistDiscovery) ([]spotifyapi.Track, error) {
-	worker.logger.Info(fmt.Sprintf("Queried %d tracks to discover artists for", len(discoveries)))
+func (worker *DiscoverWorker) discoverTracks(ctx context.Context, logger *zap.Logger, discoveries []db.ArtistDiscovery) ([]spotifyapi.Track, error) {
+	logger.Info(fmt.Sprintf("Queried %d tracks to discover artists for", len(discoveries)))
 
 	var trackIds []string
 	for _, track := range discoveries {
 		trackIds = append(trackIds, track.TrackUri)
 	}
 
-	worker.logger.Info("Requesting tracks...")
+	logger.Info("Requesting tracks...")
 
-	foundTracks, err := worker.spotifyClient.GetTracks(trackIds)
+	ctx, span := tracer.Start(ctx, "discovery.GetTracks", trace.WithAttributes(
+		attribute.Int("discovery.track_ids", len(trackIds)),
+	))
+	foundTracks, err := worker.spotifyClient.GetTracks(ctx, trackIds)
+	endSpan(span, err)
 	if err != nil {
-		worker.logger.Error("Error while fetching tracks", zap.Error(err))
+		logger.Error("Error while fetching tracks", zap.Error(err))
 		return nil, err
 	}
 
 	return foundTracks, nil
 }
 
-func (worker *DiscoverWorker) transformTracksAndExtractArtistIds(foundTracks []spotifyapi.Track) ([]db.Track, []string) {
-	worker.logger.Info("Transforming tracks and extracting artists...")
+func (worker *DiscoverWorker) transformTracksAndExtractArtistIds(logger *zap.Logger, foundTracks []spotifyapi.Track) ([]db.Track, []string) {
+	logger.Info("Transforming tracks and extracting artists...")
 	var artistIds []string
 	var dbTracks []db.Track
 	for _, track := range foundTracks {
+		// Spotify answers unknown ids with null
+		if track.Id == "" || track.Duration == nil || track.Artists == nil {
+			logger.Warn("Skipping unknown or incomplete track", zap.String("id", track.Id))
+			continue
+		}
+
 		dbTrack := db.Track{
 			BaseSpotifyModel: db.BaseSpotifyModel{
 				ID: track.Id,
@@ -223,12 +345,16 @@ func (worker *DiscoverWorker) transformTracksAndExtractArtistIds(foundTracks []s
 	return dbTracks, artistIds
 }
 
-func (worker *DiscoverWorker) filterForExistingArtists(artistIds []string, tx *gorm.DB) ([]string, error) {
-	worker.logger.Info("Filtering already existing artists...")
+func (worker *DiscoverWorker) filterForExistingArtists(ctx context.Context, logger *zap.Logger, artistIds []string, tx *gorm.DB) ([]string, error) {
+	logger.Info("Filtering already existing artists...")
+	ctx, span := tracer.Start(ctx, "discovery.filterForExistingArtists", trace.WithAttributes(
+		attribute.Int("discovery.artist_ids", len(artistIds)),
+	))
 	var alreadyExistingArtists []db.Artist
-	res := tx.Where("id IN (?)", artistIds).Find(&alreadyExistingArtists)
+	res := tx.WithContext(ctx).Where("id IN (?)", artistIds).Find(&alreadyExistingArtists)
+	endSpan(span, res.Error)
 	if res.Error != nil {
-		worker.logger.Error("Error while querying existing artists", zap.Error(res.Error))
+		logger.Error("Error while querying existing artists", zap.Error(res.Error))
 		return nil, res.Error
 	}
 
@@ -247,3 +373,39 @@ func (worker *DiscoverWorker) filterForExistingArtists(artistIds []string, tx *g
 
 	return filteredIds, nil
 }
+
+// batchContext carries the request ids of the API calls that enqueued the batch, so Spotify calls and logs
+// of the batch can be correlated with them. A batch of a single request forwards its id to Spotify, a batch
+// mixing several gets an id of its own which is logged next to the ids it stands for.
+func (worker *DiscoverWorker) batchContext(ctx context.Context, discoveries []db.ArtistDiscovery) (context.Context, *zap.Logger) {
+	var requestIds []string
+	for _, discovery := range discoveries {
+		if discovery.RequestID != "" && !slices.Contains(requestIds, discovery.RequestID) {
+			requestIds = append(requestIds, discovery.RequestID)
+		}
+	}
+
+	if len(requestIds) == 0 {
+		return ctx, worker.logger
+	}
+
+	batchId := requestIds[0]
+	if len(requestIds) > 1 {
+		batchId = requestid.Generate()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("request.id", batchId),
+		attribute.StringSlice("request.ids", requestIds),
+	)
+	ctx = requestid.NewContext(ctx, batchId)
+	return ctx, worker.logger.With(zap.String("request_id", batchId), zap.Strings("request_ids", requestIds))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,181 @@
+package health
+
+import (
+	"backend/db"
+	"backend/discovery"
+	"backend/spotifyapi"
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+// DatabaseCheck pings the database connection pool.
+func DatabaseCheck(database *gorm.DB) CheckFunc {
+	return func(ctx context.Context) ComponentStatus {
+		sqlDB, err := database.DB()
+		if err != nil {
+			return ComponentStatus{Status: StatusDown, Message: "database is unreachable", Cause: err}
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+		if err = sqlDB.PingContext(ctx); err != nil {
+			return ComponentStatus{Status: StatusDown, Message: "database is unreachable", Cause: err}
+		}
+
+		return ComponentStatus{Status: StatusUp}
+	}
+}
+
+// ListenerState tracks the connection of the LISTEN/NOTIFY listener from its event callback.
+type ListenerState struct {
+	lock      sync.RWMutex
+	connected bool
+	lastEvent time.Time
+	lastError error
+}
+
+func (l *ListenerState) Update(event pq.ListenerEventType, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.connected = event == pq.ListenerEventConnected || event == pq.ListenerEventReconnected
+	l.lastEvent = time.Now()
+	l.lastError = err
+}
+
+// SetError records a failure not reported through the listener callback, e.g. of Listen or Ping.
+func (l *ListenerState) SetError(err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lastError = err
+	if err != nil {
+		l.connected = false
+	}
+}
+
+// SetConnected marks the listener connected after a successful Listen or Ping.
+func (l *ListenerState) SetConnected() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.connected = true
+	l.lastEvent = time.Now()
+	l.lastError = nil
+}
+
+func (l *ListenerState) Check(context.Context) ComponentStatus {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	details := map[string]any{}
+	if !l.lastEvent.IsZero() {
+		details["lastEvent"] = l.lastEvent
+	}
+
+	if !l.connected {
+		return ComponentStatus{Status: StatusDown, Message: "listener is not connected", Details: details, Cause: l.lastError}
+	}
+
+	return ComponentStatus{Status: StatusUp, Details: details}
+}
+
+// SpotifyLoginCheck reports the last login attempt of the Spotify client.
+func SpotifyLoginCheck(client spotifyapi.SpotifyClient) CheckFunc {
+	return func(context.Context) ComponentStatus {
+		status := client.LoginStatus()
+		if !status.Enabled {
+			return ComponentStatus{Status: StatusDisabled, Message: "no spotify configuration present"}
+		}
+
+		details := map[string]any{}
+		if !status.LastSuccess.IsZero() {
+			details["lastSuccess"] = status.LastSuccess
+			details["expiresAt"] = status.ExpiresAt
+		}
+
+		if status.LastError != nil {
+			details["lastAttempt"] = status.LastAttempt
+			return ComponentStatus{Status: StatusDown, Message: "spotify login failed", Details: details, Cause: status.LastError}
+		}
+
+		if status.LastSuccess.IsZero() {
+			return ComponentStatus{Status: StatusUp, Message: "no login attempted yet", Details: details}
+		}
+
+		return ComponentStatus{Status: StatusUp, Details: details}
+	}
+}
+
+// WorkerCheck reports a worker whose heartbeat is older than maxSilence as down.
+func WorkerCheck(worker *discovery.DiscoverWorker, maxSilence time.Duration) CheckFunc {
+	return func(context.Context) ComponentStatus {
+		heartbeat := worker.LastHeartbeat()
+		details := map[string]any{"working": worker.IsWorking()}
+		if heartbeat.IsZero() {
+			return ComponentStatus{Status: StatusDown, Message: "worker has not run yet", Details: details}
+		}
+
+		details["lastHeartbeat"] = heartbeat
+		if silence := time.Since(heartbeat); silence > maxSilence {
+			return ComponentStatus{
+				Status:  StatusDown,
+				Message: fmt.Sprintf("no heartbeat for %s", silence.Round(time.Second)),
+				Details: details,
+			}
+		}
+
+		return ComponentStatus{Status: StatusUp, Details: details}
+	}
+}
+
+// QueueCheck reports the age of the oldest pending discovery and degrades once it exceeds maxAge.
+func QueueCheck(database *gorm.DB, maxAge time.Duration) CheckFunc {
+	return func(ctx context.Context) ComponentStatus {
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+
+		var pending struct {
+			Count  int64
+			Oldest *time.Time
+		}
+		res := database.WithContext(ctx).
+			Model(&db.ArtistDiscovery{}).
+			Select("COUNT(*) AS count, MIN(created_at) AS oldest").
+			Scan(&pending)
+		if res.Error != nil {
+			return ComponentStatus{Status: StatusDown, Message: "queue could not be read", Cause: res.Error}
+		}
+
+		details := map[string]any{"pending": pending.Count}
+		if pending.Oldest == nil {
+			return ComponentStatus{Status: StatusUp, Details: details}
+		}
+
+		age := time.Since(*pending.Oldest)
+		details["oldestAgeSeconds"] = int64(age.Seconds())
+		if age > maxAge {
+			return ComponentStatus{
+				Status:  StatusDown,
+				Message: fmt.Sprintf("oldest discovery is waiting for %s", age.Round(time.Second)),
+				Details: details,
+			}
+		}
+
+		return ComponentStatus{Status: StatusUp, Details: details}
+	}
+}
+
+// LeaderOnly reports check as disabled while this process is not the elected discovery leader, as components
+// like the worker and the listener are only active on the leader.
+func LeaderOnly(isLeader func() bool, check CheckFunc) CheckFunc {
+	return func(ctx context.Context) ComponentStatus {
+		if !isLeader() {
+			return ComponentStatus{Status: StatusDisabled, Message: "discovery runs in another process"}
+		}
+		return check(ctx)
+	}
+}
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+	StatusDisabled = "disabled"
+)
+
+// ComponentStatus is the result of a single component check. The report is served without authentication,
+// so Message stays generic and the error behind it is kept in Cause, which is only logged.
+type ComponentStatus struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+	Cause   error          `json:"-"`
+}
+
+// Report is the aggregated readiness of all registered components.
+type Report struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checkedAt"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+type CheckFunc func(ctx context.Context) ComponentStatus
+
+type registeredCheck struct {
+	name     string
+	check    CheckFunc
+	critical bool
+}
+
+// Registry runs the registered component checks. A failing critical component makes the whole report down,
+// failing non critical components only degrade it.
+type Registry struct {
+	logger *zap.Logger
+	lock   sync.RWMutex
+	checks []registeredCheck
+}
+
+// NewRegistry returns an empty registry logging the causes of failed checks to logger.
+func NewRegistry(logger *zap.Logger) *Registry {
+	return &Registry{logger: logger}
+}
+
+func (r *Registry) Register(name string, critical bool, check CheckFunc) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.checks = append(r.checks, registeredCheck{name: name, check: check, critical: critical})
+}
+
+func (r *Registry) Check(ctx context.Context) Report {
+	r.lock.RLock()
+	checks := append([]registeredCheck(nil), r.checks...)
+	r.lock.RUnlock()
+
+	report := Report{
+		Status:     StatusUp,
+		CheckedAt:  time.Now(),
+		Components: make(map[string]ComponentStatus, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := check.check(ctx)
+			if status.Cause != nil && r.logger != nil {
+				r.logger.Warn("health check failed", zap.String("component", check.name), zap.Error(status.Cause))
+			}
+
+			resultLock.Lock()
+			defer resultLock.Unlock()
+			report.Components[check.name] = status
+			report.Status = worseStatus(report.Status, effectiveStatus(status.Status, check.critical))
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func effectiveStatus(status string, critical bool) string {
+	if status == StatusDown && !critical {
+		return StatusDegraded
+	}
+	return status
+}
+
+func worseStatus(current string, other string) string {
+	rank := map[string]int{StatusUp: 0, StatusDisabled: 0, StatusDegraded: 1, StatusDown: 2}
+	if rank[other] > rank[current] {
+		return other
+	}
+	return current
+}
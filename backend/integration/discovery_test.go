@@ -0,0 +1,192 @@
+package integration
+
+import (
+	"backend/api"
+	"backend/config"
+	"backend/mockserver"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const harnessUser = "harness"
+
+// maxArtistsPerRequest is the default limit of artists per POST /discover the harness API runs with.
+const maxArtistsPerRequest = 20_000
+
+// TestDiscoveryPipeline sends every post of a case to POST /discover and, if it was accepted, waits for the
+// worker run its NOTIFY triggers. The queue and user stats read afterwards must match exactly, as the seeded
+// mock server always returns the same tracks and artists.
+func TestDiscoveryPipeline(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    Options
+		posts      [][]api.DiscoveredArtist
+		wantStatus int
+		// wantProblem is the body every post must be rejected with, its request id is not compared.
+		wantProblem *api.Problem
+		// discoverAll expects every posted track and its artists to be stored, otherwise none may be.
+		discoverAll   bool
+		wantRemaining int64
+	}{
+		{
+			name:        "single track",
+			posts:       [][]api.DiscoveredArtist{tracks(0, 1)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name:        "more tracks than fit in a batch",
+			options:     Options{BatchSize: 20},
+			posts:       [][]api.DiscoveredArtist{tracks(0, 75)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name:        "more artists than fit in a spotify request",
+			posts:       [][]api.DiscoveredArtist{tracks(0, 50)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name:        "tracks of already discovered artists",
+			posts:       [][]api.DiscoveredArtist{tracks(0, 30), tracks(0, 30)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name:        "overlapping imports",
+			posts:       [][]api.DiscoveredArtist{tracks(0, 30), tracks(20, 30)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name:       "tracks unknown to spotify",
+			options:    Options{Fallback: mockserver.FallbackNotFound},
+			posts:      [][]api.DiscoveredArtist{tracks(0, 10)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "server errors are retried",
+			options: Options{Scenario: config.MockScenarioConfig{Faults: map[string]config.MockFaultsConfig{
+				"*": {InternalError: 0.15, BadGateway: 0.05},
+			}}},
+			posts:       [][]api.DiscoveredArtist{tracks(0, 60)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name: "rejected tokens are renewed",
+			options: Options{Scenario: config.MockScenarioConfig{Faults: map[string]config.MockFaultsConfig{
+				"tracks":  {ExpiredToken: 0.2},
+				"artists": {ExpiredToken: 0.2},
+			}}},
+			posts:       [][]api.DiscoveredArtist{tracks(0, 60)},
+			wantStatus:  http.StatusOK,
+			discoverAll: true,
+		},
+		{
+			name: "null entries are dropped from the queue",
+			options: Options{Scenario: config.MockScenarioConfig{Faults: map[string]config.MockFaultsConfig{
+				"tracks": {NullEntries: 1},
+			}}},
+			posts:      [][]api.DiscoveredArtist{tracks(0, 40)},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "rate limited requests keep the queue",
+			options: Options{Scenario: config.MockScenarioConfig{Faults: map[string]config.MockFaultsConfig{
+				"tracks": {RateLimited: 1},
+			}}},
+			posts:         [][]api.DiscoveredArtist{tracks(0, 10)},
+			wantStatus:    http.StatusOK,
+			wantRemaining: 10,
+		},
+		{
+			name:       "invalid imports are rejected",
+			posts:      [][]api.DiscoveredArtist{{{ArtistName: "", TrackUri: trackId(0)}}},
+			wantStatus: http.StatusBadRequest,
+			wantProblem: &api.Problem{
+				Type:    "https://spotify-viz/problems/validation-failed",
+				Title:   "Bad Request",
+				Status:  http.StatusBadRequest,
+				Code:    api.CodeValidation,
+				Message: "request validation failed",
+				Details: []api.ProblemDetail{{Field: "artists[0].artistName", Message: "is required"}},
+			},
+		},
+		{
+			name:       "more artists than allowed per import are rejected",
+			posts:      [][]api.DiscoveredArtist{tracks(0, maxArtistsPerRequest+1)},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantProblem: &api.Problem{
+				Type:    "https://spotify-viz/problems/too-many-artists",
+				Title:   "Unprocessable Entity",
+				Status:  http.StatusUnprocessableEntity,
+				Code:    api.CodeTooManyArtists,
+				Message: fmt.Sprintf("at most %d artists are allowed per request, got %d", maxArtistsPerRequest, maxArtistsPerRequest+1),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newHarness(t, test.options)
+
+			posted := make(map[string]bool)
+			for i, artists := range test.posts {
+				before := time.Now()
+				status, problem := h.postDiscover(harnessUser, artists)
+				if status != test.wantStatus {
+					t.Fatalf("post %d: want status %d, got %d", i+1, test.wantStatus, status)
+				}
+				if problem != nil {
+					problem.RequestID = ""
+				}
+				if !reflect.DeepEqual(problem, test.wantProblem) {
+					t.Errorf("post %d: want problem %+v, got %+v", i+1, test.wantProblem, problem)
+				}
+				if test.wantStatus != http.StatusOK {
+					continue
+				}
+
+				for _, artist := range artists {
+					posted[artist.TrackUri] = true
+				}
+				h.waitForRun(before)
+			}
+
+			var wantArtists, wantTracks int64
+			if test.discoverAll {
+				trackIds := make([]string, 0, len(posted))
+				for id := range posted {
+					trackIds = append(trackIds, id)
+				}
+				wantArtists, wantTracks = reference(t, trackIds)
+			}
+
+			var status api.StatusReport
+			h.get("/api/v1/discover/status", harnessUser, &status)
+			if status.AlreadyDiscoveredCount != wantArtists {
+				t.Errorf("want %d discovered artists, got %d", wantArtists, status.AlreadyDiscoveredCount)
+			}
+			if status.RemainingArtistsCount != test.wantRemaining {
+				t.Errorf("want %d queued tracks to remain, got %d", test.wantRemaining, status.RemainingArtistsCount)
+			}
+
+			var stats api.UserStatsReport
+			h.get("/api/v1/me/stats", harnessUser, &stats)
+			if stats.TracksCount != int64(len(posted)) {
+				t.Errorf("want %d tracks of the user, got %d", len(posted), stats.TracksCount)
+			}
+			if stats.DiscoveredTracksCount != wantTracks {
+				t.Errorf("want %d discovered tracks of the user, got %d", wantTracks, stats.DiscoveredTracksCount)
+			}
+			if stats.RemainingTracksCount != test.wantRemaining {
+				t.Errorf("want %d remaining tracks of the user, got %d", test.wantRemaining, stats.RemainingTracksCount)
+			}
+		})
+	}
+}
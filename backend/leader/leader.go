@@ -0,0 +1,127 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+// Elector elects a single leader among all processes sharing a database by holding a session level postgres
+// advisory lock on a dedicated connection. The lock is released by postgres as soon as that connection dies,
+// so a crashed leader is replaced after at most one retry interval.
+type Elector struct {
+	db            *sql.DB
+	key           int64
+	retryInterval time.Duration
+	logger        *zap.Logger
+
+	isLeader atomic.Bool
+}
+
+func NewElector(db *sql.DB, key int64, retryInterval time.Duration, logger *zap.Logger) *Elector {
+	return &Elector{
+		db:            db,
+		key:           key,
+		retryInterval: retryInterval,
+		logger:        logger.With(zap.Int64("lock_key", key)),
+	}
+}
+
+// IsLeader reports whether this process currently holds the lock.
+func (e *Elector) IsLeader() bool {
+	return e.isLeader.Load()
+}
+
+// Run campaigns for leadership until ctx is done. Whenever the lock is acquired lead is called with a context
+// that is cancelled once the lock's connection is lost. The lock is released after lead returns.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		if _, err := e.RunOnce(ctx, lead); err != nil {
+			e.logger.Warn("failed to campaign for leadership", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retryInterval):
+		}
+	}
+}
+
+// RunOnce calls lead if the lock can be acquired right away and reports whether it was.
+func (e *Elector) RunOnce(ctx context.Context, lead func(ctx context.Context)) (bool, error) {
+	conn, acquired, err := e.tryAcquire(ctx)
+	if err != nil || !acquired {
+		return false, err
+	}
+
+	e.lead(ctx, conn, lead)
+	return true, nil
+}
+
+func (e *Elector) tryAcquire(ctx context.Context) (*sql.Conn, bool, error) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var acquired bool
+	if err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired); err != nil || !acquired {
+		_ = conn.Close()
+		return nil, false, err
+	}
+
+	return conn, true, nil
+}
+
+func (e *Elector) lead(ctx context.Context, conn *sql.Conn, lead func(ctx context.Context)) {
+	e.logger.Info("acquired leadership")
+	e.isLeader.Store(true)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(e.retryInterval)
+	defer ticker.Stop()
+
+watch:
+	for {
+		select {
+		case <-done:
+			break watch
+		case <-ticker.C:
+			if err := conn.PingContext(ctx); err != nil {
+				e.logger.Warn("lost leadership", zap.Error(err))
+				cancel()
+				<-done
+				break watch
+			}
+		}
+	}
+
+	cancel()
+	e.isLeader.Store(false)
+	e.release(conn)
+	e.logger.Info("released leadership")
+}
+
+// release unlocks and discards the connection, so the lock can never stay held by a pooled connection.
+func (e *Elector) release(conn *sql.Conn) {
+	unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", e.key); err != nil {
+		e.logger.Warn("failed to release leadership lock", zap.Error(err))
+	}
+
+	_ = conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+	_ = conn.Close()
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"maps"
+	"slices"
+)
+
+const (
+	ComponentApp       = "app"
+	ComponentApi       = "api"
+	ComponentDiscovery = "discovery"
+	ComponentSpotify   = "spotifyapi"
+)
+
+var (
+	ErrUnknownComponent  = errors.New("unknown log component")
+	ErrInactiveComponent = errors.New("log component does not run in this process")
+)
+
+// Levels holds an adjustable level per component. ComponentApp covers everything not logging through one
+// of the other components.
+type Levels struct {
+	levels map[string]zap.AtomicLevel
+	// active restricts the components of a view returned by Only, nil for all.
+	active []string
+}
+
+func newLevels(defaultLevel zapcore.Level) *Levels {
+	levels := &Levels{levels: make(map[string]zap.AtomicLevel)}
+	for _, component := range []string{ComponentApp, ComponentApi, ComponentDiscovery, ComponentSpotify} {
+		levels.levels[component] = zap.NewAtomicLevelAt(defaultLevel)
+	}
+	return levels
+}
+
+// Only returns a view of the levels limited to components, sharing their levels with l. The API server of
+// the serve command gets one without the discovery components, as those only run in the worker processes.
+func (l *Levels) Only(components ...string) *Levels {
+	return &Levels{levels: l.levels, active: components}
+}
+
+func (l *Levels) isActive(component string) bool {
+	return l.active == nil || slices.Contains(l.active, component)
+}
+
+// Levels returns the current level of every component running in this process.
+func (l *Levels) Levels() map[string]string {
+	current := make(map[string]string, len(l.levels))
+	for component, level := range l.levels {
+		if l.isActive(component) {
+			current[component] = level.String()
+		}
+	}
+	return current
+}
+
+// Components lists the known components in a stable order.
+func (l *Levels) Components() []string {
+	return slices.Sorted(maps.Keys(l.levels))
+}
+
+// SetLevel changes the level of a component at runtime.
+func (l *Levels) SetLevel(component string, level string) error {
+	atomicLevel, exists := l.levels[component]
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownComponent, component)
+	}
+	if !l.isActive(component) {
+		return fmt.Errorf("%w: %q", ErrInactiveComponent, component)
+	}
+
+	parsed, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	atomicLevel.SetLevel(parsed)
+	return nil
+}
+
+// componentCore drops entries below the level of its component before they reach the sinks.
+type componentCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c *componentCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) && c.Core.Enabled(level)
+}
+
+func (c *componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &componentCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *componentCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+func (c *componentCore) Level() zapcore.Level {
+	return max(c.level.Level(), zapcore.LevelOf(c.Core))
+}
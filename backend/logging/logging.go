@@ -0,0 +1,170 @@
+package logging
+
+import (
+	"backend/config"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"os"
+)
+
+const (
+	SinkConsole = "console"
+	SinkFile    = "file"
+	SinkJson    = "json"
+)
+
+// Logging owns the sinks of the application log and the levels of its components.
+type Logging struct {
+	Levels *Levels
+
+	core    zapcore.Core
+	options []zap.Option
+	sinks   map[string]zap.AtomicLevel
+	closers []io.Closer
+}
+
+// New builds the console sink and, if a log file is configured, the rotating text and json file sinks.
+func New(cfg config.LoggingConfig) (*Logging, error) {
+	production := cfg.Zap != nil && *cfg.Zap == "production"
+
+	logging := &Logging{
+		Levels:  newLevels(DefaultLevel(cfg)),
+		options: []zap.Option{zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel)},
+		sinks:   make(map[string]zap.AtomicLevel),
+	}
+	if !production {
+		logging.options = append(logging.options, zap.Development())
+	}
+
+	var consoleEncoder zapcore.Encoder
+	if production {
+		consoleEncoder = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	} else {
+		consoleEncoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	}
+	cores := []zapcore.Core{logging.sinkCore(SinkConsole, consoleEncoder, zapcore.Lock(os.Stdout))}
+
+	if cfg.File != nil {
+		fileEncoderConfig := zap.NewProductionEncoderConfig()
+		fileEncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+		file := NewRotatingFile(*cfg.File, cfg.Rotation)
+		jsonFile := NewRotatingFile(fmt.Sprintf("%s.json", *cfg.File), cfg.Rotation)
+		logging.closers = append(logging.closers, file, jsonFile)
+
+		cores = append(cores,
+			logging.sinkCore(SinkFile, zapcore.NewConsoleEncoder(fileEncoderConfig), zapcore.AddSync(file)),
+			logging.sinkCore(SinkJson, zapcore.NewJSONEncoder(fileEncoderConfig), zapcore.AddSync(jsonFile)),
+		)
+	}
+
+	logging.core = zapcore.NewTee(cores...)
+	if err := logging.Apply(cfg); err != nil {
+		return nil, err
+	}
+
+	return logging, nil
+}
+
+// NewRotatingFile opens a log file rotated by size and pruned by age and count as configured. Lumberjack has no
+// time based rotation, age only decides when rotated files are deleted.
+func NewRotatingFile(path string, rotation *config.LogRotationConfig) *lumberjack.Logger {
+	file := &lumberjack.Logger{Filename: path}
+	if rotation != nil {
+		file.MaxSize = rotation.MaxSizeMB
+		file.MaxAge = rotation.MaxAgeDays
+		file.MaxBackups = rotation.MaxBackups
+		file.Compress = rotation.Compress != nil && *rotation.Compress
+	}
+	return file
+}
+
+func (l *Logging) sinkCore(sink string, encoder zapcore.Encoder, writer zapcore.WriteSyncer) zapcore.Core {
+	level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	l.sinks[sink] = level
+	return zapcore.NewCore(encoder, writer, level)
+}
+
+// Logger returns the application logger, filtered by the level of ComponentApp.
+func (l *Logging) Logger() *zap.Logger {
+	return l.Component(ComponentApp)
+}
+
+// Component returns a logger named after and filtered by the level of the given component.
+func (l *Logging) Component(component string) *zap.Logger {
+	level, exists := l.Levels.levels[component]
+	if !exists {
+		level = l.Levels.levels[ComponentApp]
+	}
+
+	logger := zap.New(&componentCore{Core: l.core, level: level}, l.options...)
+	if component != ComponentApp {
+		logger = logger.Named(component)
+	}
+	return logger
+}
+
+// Apply sets the component and sink levels from the config. Levels changed at runtime are overwritten.
+func (l *Logging) Apply(cfg config.LoggingConfig) error {
+	defaultLevel := DefaultLevel(cfg)
+	for _, component := range l.Levels.Components() {
+		level := defaultLevel.String()
+		if override, exists := cfg.Components[component]; exists {
+			level = override
+		}
+		if err := l.Levels.SetLevel(component, level); err != nil {
+			return err
+		}
+	}
+
+	var sinkLevels config.LogSinksConfig
+	if cfg.Sinks != nil {
+		sinkLevels = *cfg.Sinks
+	}
+	for sink, configured := range map[string]string{SinkConsole: sinkLevels.Console, SinkFile: sinkLevels.File, SinkJson: sinkLevels.Json} {
+		level, exists := l.sinks[sink]
+		if !exists {
+			continue
+		}
+
+		parsed := zapcore.DebugLevel
+		if configured != "" {
+			var err error
+			if parsed, err = zapcore.ParseLevel(configured); err != nil {
+				return err
+			}
+		}
+		level.SetLevel(parsed)
+	}
+
+	return nil
+}
+
+// Close flushes and closes the log files.
+func (l *Logging) Close() error {
+	_ = l.core.Sync()
+
+	var errs []error
+	for _, closer := range l.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DefaultLevel returns the configured level, defaulting to debug in development and info in production.
+func DefaultLevel(cfg config.LoggingConfig) zapcore.Level {
+	if cfg.Level != nil {
+		if level, err := zapcore.ParseLevel(*cfg.Level); err == nil {
+			return level
+		}
+	}
+
+	if cfg.Zap != nil && *cfg.Zap == "production" {
+		return zapcore.InfoLevel
+	}
+	return zapcore.DebugLevel
+}
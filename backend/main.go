@@ -1,196 +1,289 @@
 package main
 
 import (
-	"backend/api"
 	"backend/config"
 	"backend/db"
 	"backend/discovery"
-	"backend/mockserver"
+	"backend/health"
+	"backend/logging"
+	"backend/metrics"
 	"backend/spotifyapi"
-	"backend/stripper"
+	"backend/telemetry"
+	"context"
+	"flag"
 	"fmt"
-	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/plugin/opentelemetry/tracing"
 	"io"
 	"log"
+	"math"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+const usage = `usage: backend [-config file] [-set path=value]... [command] [arguments]
+
+Without a command the API server, the discovery worker and, if configured, the mock server are started together.
+API servers scale freely, of all processes running the worker only the one holding the discovery lock in
+postgres discovers while the others stand by.
+
+commands:
+  serve                       run the API server
+  worker                      run the discovery worker, or stand by while another process runs it
+  mock                        run the Spotify mock server
+  migrate up                  apply all pending migrations
+  migrate down [-steps n]     revert the most recent migrations
+  migrate status              list migrations and when they were applied
+  import [-user name] <file>  queue a Streaming_History JSON export for discovery
+  discover [-once]            run the discovery worker, -once processes the queue a single time and exits
+  stats [-user name]          print discovery queue and user statistics
+
+options:
+  -config file                config file, defaults to $SPOTIFY_VIZ_CONFIG or config.yaml
+  -set path=value             override a config field, e.g. -set discover.batch_size=20
+
+Every config field can also be overridden by an environment variable named after its path, e.g.
+SPOTIFY_VIZ_SPOTIFY_CLIENT_SECRET, or read from a file named by SPOTIFY_VIZ_SPOTIFY_CLIENT_SECRET_FILE.
+${VAR} and ${VAR:-default} in the config file are expanded from the environment.
+`
+
+type command struct {
+	run func(app *application, args []string) error
+	// requires lists the config sections the command can't run without.
+	requires []string
+}
+
+var commands = map[string]command{
+	"all":      {run: runAll, requires: []string{"server", "database"}},
+	"serve":    {run: runServe, requires: []string{"server", "database"}},
+	"worker":   {run: runWorker, requires: []string{"database"}},
+	"mock":     {run: runMock, requires: []string{"mock_server"}},
+	"migrate":  {run: runMigrateCommand, requires: []string{"database"}},
+	"import":   {run: runImport, requires: []string{"database"}},
+	"discover": {run: runDiscover, requires: []string{"database"}},
+	"stats":    {run: runStats, requires: []string{"database"}},
+}
+
+// application holds the configuration and the components shared by the commands.
+type application struct {
+	// cfg is the configuration the process was started with, live holds the latest reloaded one.
+	cfg              *config.Config
+	live             atomic.Pointer[config.Config]
+	configPath       string
+	overrides        []string
+	requiredSections []string
+
+	logger          *zap.Logger
+	logging         *logging.Logging
+	closers         []io.Closer
+	shutdownTracing func(ctx context.Context) error
+}
+
+// overrideFlags collects the repeatable -set flag.
+type overrideFlags []string
+
+func (o *overrideFlags) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *overrideFlags) Set(value string) error {
+	*o = append(*o, value)
+	return nil
+}
+
 func main() {
+	defaultConfigPath := "config.yaml"
+	if path, exists := os.LookupEnv("SPOTIFY_VIZ_CONFIG"); exists {
+		defaultConfigPath = path
+	}
+
+	var overrides overrideFlags
+	configPath := flag.String("config", defaultConfigPath, "config file")
+	flag.Var(&overrides, "set", "override a config field as path=value")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	name, args := "all", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		fmt.Print(usage)
+		return
+	}
+
+	cmd, exists := commands[name]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
 	log.Println("starting application")
-	cfg := config.LoadConfig("config.yaml")
+	app, err := newApplication(*configPath, overrides, cmd.requires)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
 
-	var logger *zap.Logger
-	zapEnvironment := *cfg.Logging.Zap
-	if zapEnvironment == "production" {
-		logger, _ = zap.NewProduction()
-	} else {
-		gin.ForceConsoleColor()
-		logger, _ = zap.NewDevelopment()
+	err = cmd.run(app, args)
+	app.shutdown()
+	if err != nil {
+		app.logger.Error("command failed", zap.String("command", name), zap.Error(err))
+		os.Exit(1)
 	}
+}
 
-	var logFile *os.File
-	var jsonLogFile *os.File
-	var err error
-	var jsonLogErr error
-	if cfg.Logging.File != nil {
-		logFile, err = os.OpenFile(*cfg.Logging.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		jsonLogFile, jsonLogErr = os.OpenFile(fmt.Sprintf("%s.json", *cfg.Logging.File), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			logger.Warn("error creating file", zap.String("file", *cfg.Logging.File), zap.Error(err))
-		} else if jsonLogErr != nil {
-			logger.Warn("error creating json log file", zap.String("file", *cfg.Logging.File), zap.Error(err))
-		} else {
-			consoleEncoder := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
-			fileEncoderConfig := zap.NewProductionEncoderConfig()
-			fileEncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-			fileEncoder := zapcore.NewConsoleEncoder(fileEncoderConfig)
-			jsonFileEncoder := zapcore.NewJSONEncoder(fileEncoderConfig)
-			consoleWriter := zapcore.Lock(os.Stdout)
-			fileWriter := zapcore.AddSync(logFile)
-			jsonWriter := zapcore.AddSync(jsonLogFile)
-
-			core := zapcore.NewTee(
-				zapcore.NewCore(consoleEncoder, consoleWriter, zapcore.DebugLevel),
-				zapcore.NewCore(fileEncoder, fileWriter, zapcore.DebugLevel),
-				zapcore.NewCore(jsonFileEncoder, jsonWriter, zapcore.DebugLevel),
-			)
-
-			logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
-		}
+// newApplication loads and validates the configuration and sets up logging and tracing shared by all commands.
+func newApplication(configPath string, overrides []string, requiredSections []string) (*application, error) {
+	cfg, err := config.LoadConfig(configPath, overrides...)
+	if err != nil {
+		return nil, err
 	}
 
-	var apiLogFile *os.File
-	if cfg.Logging.ApiFile != nil {
-		apiLogFile, err = os.OpenFile(*cfg.Logging.ApiFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			logger.Warn("error creating api log file", zap.String("file", *cfg.Logging.ApiFile), zap.Error(err))
-		} else {
-			stripWriter := stripper.StripColorWriter{W: apiLogFile}
-			gin.DefaultWriter = io.MultiWriter(&stripWriter)
-		}
+	if err = cfg.Validate(requiredSections...); err != nil {
+		return nil, err
 	}
 
+	appLogging, err := logging.New(cfg.Logging)
+	if err != nil {
+		return nil, err
+	}
+	logger := appLogging.Logger()
+
 	zap.ReplaceGlobals(logger)
 	logger.Info("config loaded and loggers initialized")
+	for _, deprecation := range cfg.Deprecations() {
+		logger.Warn("deprecated config setting", zap.String("setting", deprecation))
+	}
 
-	if cfg.Server == nil {
-		logger.Fatal("no server configuration present")
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.TracingConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize tracing: %w", err)
 	}
 
-	if cfg.DatabaseConfig == nil {
-		logger.Fatal("no database configuration present")
+	app := &application{
+		cfg:              cfg,
+		configPath:       configPath,
+		overrides:        overrides,
+		requiredSections: requiredSections,
+		logger:           logger,
+		logging:          appLogging,
+		shutdownTracing:  shutdownTracing,
+	}
+	app.live.Store(cfg)
+	return app, nil
+}
+
+func (app *application) shutdown() {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := app.shutdownTracing(shutdownCtx); err != nil {
+		app.logger.Warn("failed to flush traces", zap.Error(err))
+	}
+	for _, closer := range app.closers {
+		_ = closer.Close()
 	}
+	_ = app.logging.Close()
+}
 
+// openDatabase connects to the configured database without touching its schema.
+func (app *application) openDatabase() (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
-		cfg.DatabaseConfig.Host,
-		cfg.DatabaseConfig.Username,
-		cfg.DatabaseConfig.Password,
-		cfg.DatabaseConfig.Database,
-		cfg.DatabaseConfig.Port,
+		app.cfg.DatabaseConfig.Host,
+		app.cfg.DatabaseConfig.Username,
+		app.cfg.DatabaseConfig.Password,
+		app.cfg.DatabaseConfig.Database,
+		app.cfg.DatabaseConfig.Port,
 	)
 
 	dbConn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
 
-	otherDsn := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.DatabaseConfig.Username,
-		cfg.DatabaseConfig.Password,
-		cfg.DatabaseConfig.Host,
-		cfg.DatabaseConfig.Port,
-		cfg.DatabaseConfig.Database,
-	)
-
-	listener := pq.NewListener(otherDsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
-		if err != nil {
-			logger.Error("Listener error", zap.Error(err))
-		}
-	})
+	return dbConn, nil
+}
 
+// prepareDatabase connects to the database, brings its schema up to date and instruments the connection.
+func (app *application) prepareDatabase() (*gorm.DB, error) {
+	dbConn, err := app.openDatabase()
 	if err != nil {
-		logger.Fatal("failed to connect to database", zap.Error(err))
-	} else {
-		err = dbConn.AutoMigrate(&db.Track{}, &db.Artist{}, &db.ArtistDiscovery{})
-		if err != nil {
-			logger.Fatal("failed to migrate database", zap.Error(err))
-		}
+		return nil, err
 	}
 
-	var spotifyClient spotifyapi.SpotifyClient
-	if cfg.SpotifyConfig == nil {
-		logger.Warn("no spotify configuration present, operating in data collection mode")
-		spotifyClient = &spotifyapi.NoopClient{Logger: logger}
-	} else {
-		spotifyClient = spotifyapi.NewSpotifyClient(
-			*cfg.SpotifyConfig,
-			logger,
-		)
+	if err = migrateOnStartup(dbConn, *app.cfg.DatabaseConfig.AutoMigrate, app.logger); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	go func() {
-		listenErr := listener.Listen("discovery")
-		if listenErr != nil {
-			logger.Error("Listener init error", zap.Error(err))
-		}
+	registerDatabaseMetrics(dbConn, app.logger)
 
-		worker := discovery.NewDiscoverWorker(
-			cfg.DiscoverConfig.BatchSize,
-			spotifyClient,
-			dbConn,
-			logger,
-		)
+	if err = dbConn.Use(tracing.NewPlugin(tracing.WithoutMetrics())); err != nil {
+		app.logger.Warn("failed to instrument database", zap.Error(err))
+	}
 
-		worker.Run()
+	return dbConn, nil
+}
 
-		interval := 5 * time.Minute
-		if cfg.DiscoverConfig.RetryInterval != nil {
-			interval = *cfg.DiscoverConfig.RetryInterval
-		}
-		timer := time.NewTicker(interval)
-
-		for {
-			select {
-			case notification := <-listener.Notify:
-				logger.Info("Got new notification", zap.Any("notification", notification))
-				worker.Run()
-			case <-time.After(90 * time.Second):
-				go listener.Ping()
-			case <-timer.C:
-				timer.Stop()
-				worker.Run()
-				timer = time.NewTicker(interval)
-			}
-		}
-	}()
+func (app *application) newListener(listenerState *health.ListenerState) *pq.Listener {
+	dsn := fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		app.cfg.DatabaseConfig.Username,
+		app.cfg.DatabaseConfig.Password,
+		app.cfg.DatabaseConfig.Host,
+		app.cfg.DatabaseConfig.Port,
+		app.cfg.DatabaseConfig.Database,
+	)
 
-	go func() {
-		apiServer := api.NewServer(logger, spotifyClient, *cfg.Server, dbConn)
-		err := apiServer.Run()
+	return pq.NewListener(dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		listenerState.Update(event, err)
 		if err != nil {
-			logger.Fatal("failed to start server: %v", zap.Error(err))
+			app.logger.Error("Listener error", zap.Error(err))
 		}
-	}()
+	})
+}
+
+func (app *application) newSpotifyClient() spotifyapi.SpotifyClient {
+	if app.cfg.SpotifyConfig == nil {
+		app.logger.Warn("no spotify configuration present, operating in data collection mode")
+		return &spotifyapi.NoopClient{Logger: app.logging.Component(logging.ComponentSpotify)}
+	}
 
-	if cfg.MockServerConfig != nil {
-		go func() {
-			logger.Info("Starting Mock Server")
-			mckSrv := &mockserver.Server{
-				Logger: logger,
-				Port:   cfg.MockServerConfig.Port,
-			}
+	return spotifyapi.NewSpotifyClient(
+		*app.cfg.SpotifyConfig,
+		app.logging.Component(logging.ComponentSpotify),
+	)
+}
+
+func (app *application) newWorker(dbConn *gorm.DB, spotifyClient spotifyapi.SpotifyClient) *discovery.DiscoverWorker {
+	return discovery.NewDiscoverWorker(
+		app.cfg.DiscoverConfig.BatchSize,
+		spotifyClient,
+		dbConn,
+		app.logging.Component(logging.ComponentDiscovery),
+	)
+}
 
-			err := mckSrv.RunSpotifyMockServer()
-			if err != nil {
-				logger.Fatal("failed to start mock server: %v", zap.Error(err))
-			}
-		}()
+func registerDatabaseMetrics(dbConn *gorm.DB, logger *zap.Logger) {
+	sqlDB, err := dbConn.DB()
+	if err != nil {
+		logger.Warn("could not access database pool for metrics", zap.Error(err))
+	} else {
+		metrics.RegisterDBStats(sqlDB)
 	}
 
-	select {}
+	metrics.RegisterQueueDepth(func() float64 {
+		var count int64
+		res := dbConn.Model(&db.ArtistDiscovery{}).Count(&count)
+		if res.Error != nil {
+			logger.Warn("could not count discovery queue for metrics", zap.Error(res.Error))
+			return math.NaN()
+		}
+		return float64(count)
+	})
 }
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strings"
+)
+
+const namespace = "spotify_viz"
+
+var (
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of API requests by route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	SpotifyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "spotify",
+		Name:      "requests_total",
+		Help:      "Spotify API calls by endpoint and response status code.",
+	}, []string{"method", "endpoint", "status_code"})
+
+	SpotifyRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "spotify",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of Spotify API calls by endpoint.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "endpoint"})
+
+	SpotifyTokenExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "spotify",
+		Name:      "token_expiry_timestamp_seconds",
+		Help:      "Unix time at which the current Spotify access token expires.",
+	})
+
+	DiscoveryBatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "discovery",
+		Name:      "batches_total",
+		Help:      "Processed discovery batches by result.",
+	}, []string{"result"})
+
+	DiscoveryWorkerRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "discovery",
+		Name:      "worker_running",
+		Help:      "1 while the discovery worker is processing the queue, 0 otherwise.",
+	})
+
+	DiscoveryLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "discovery",
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Unix time at which the discovery worker finished its last run.",
+	})
+)
+
+// RegisterQueueDepth exposes the number of pending discoveries, evaluated on every scrape.
+func RegisterQueueDepth(depth func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "discovery",
+		Name:      "queue_depth",
+		Help:      "Number of artist discoveries waiting to be processed.",
+	}, depth)
+}
+
+// RegisterDBStats exposes the connection pool statistics of the database.
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "spotify_viz"))
+}
+
+// SpotifyEndpoint reduces a request path to its route, e.g. /v1/tracks/abc becomes /v1/tracks/:id.
+func SpotifyEndpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) == 3 && segments[0] == "v1" {
+		return "/v1/" + segments[1] + "/:id"
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
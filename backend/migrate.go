@@ -0,0 +1,108 @@
+package main
+
+import (
+	"backend/migrations"
+	"context"
+	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrateCommand implements `migrate up|down|status`. It only needs a database connection, pending
+// migrations are not applied before the command runs.
+func runMigrateCommand(app *application, args []string) error {
+	dbConn, err := app.openDatabase()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down [-steps n] | status")
+	}
+
+	migrator, err := migrations.NewMigrator(dbConn, app.logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, upErr := migrator.Up(ctx)
+		if upErr != nil {
+			return upErr
+		}
+		fmt.Printf("applied %d migration(s), schema is at version %d\n", applied, migrator.LatestVersion())
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if parseErr := flags.Parse(args[1:]); parseErr != nil {
+			return parseErr
+		}
+
+		reverted, downErr := migrator.Down(ctx, *steps)
+		if downErr != nil {
+			return downErr
+		}
+		fmt.Printf("reverted %d migration(s)\n", reverted)
+	case "status":
+		statuses, statusErr := migrator.Status(ctx)
+		if statusErr != nil {
+			return statusErr
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	return nil
+}
+
+// migrateOnStartup refuses to start against a schema of a newer binary and applies pending migrations
+// unless automatic migration is disabled.
+func migrateOnStartup(dbConn *gorm.DB, autoMigrate bool, logger *zap.Logger) error {
+	migrator, err := migrations.NewMigrator(dbConn, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err = migrator.CheckCompatible(ctx); err != nil {
+		return err
+	}
+
+	if !autoMigrate {
+		current, versionErr := migrator.CurrentVersion(ctx)
+		if versionErr != nil {
+			return versionErr
+		}
+		if current < migrator.LatestVersion() {
+			logger.Warn("database schema is outdated, run `migrate up`",
+				zap.Int64("current_version", current),
+				zap.Int64("latest_version", migrator.LatestVersion()),
+			)
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("database schema up to date", zap.Int("applied_migrations", applied), zap.Int64("version", migrator.LatestVersion()))
+	return nil
+}
@@ -0,0 +1,287 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// lockId is the key of the advisory lock serializing migrations between concurrently starting processes.
+const lockId = 7_352_001
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration is a row of the schema_migrations table.
+type SchemaMigration struct {
+	Version   int64 `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// MigrationStatus pairs a known migration with the time it was applied, if it was.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	logger     *zap.Logger
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, logger *zap.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(sqlFiles, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := fileNamePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("migrations: unexpected file name %s", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		content, readErr := fs.ReadFile(sqlFiles, path.Join("sql", entry.Name()))
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migrations: version %d is used by %s and %s", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// LatestVersion is the highest version known to this binary.
+func (m *Migrator) LatestVersion() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// CurrentVersion is the highest version applied to the database.
+func (m *Migrator) CurrentVersion(ctx context.Context) (int64, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+
+	var version int64
+	res := m.db.WithContext(ctx).Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version)
+	return version, res.Error
+}
+
+// CheckCompatible refuses to work with a database migrated by a newer binary.
+func (m *Migrator) CheckCompatible(ctx context.Context) error {
+	current, err := m.CurrentVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current > m.LatestVersion() {
+		return fmt.Errorf("%w: database is at version %d, this binary knows up to %d", ErrSchemaTooNew, current, m.LatestVersion())
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations in order, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		if err := m.CheckCompatible(ctx); err != nil {
+			return err
+		}
+
+		appliedVersions, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, done := appliedVersions[migration.Version]; done {
+				continue
+			}
+
+			m.logger.Info("applying migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				if res := tx.Exec(migration.Up); res.Error != nil {
+					return res.Error
+				}
+				return tx.Create(&SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the given number of most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		if err := m.CheckCompatible(ctx); err != nil {
+			return err
+		}
+
+		appliedVersions, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, done := appliedVersions[migration.Version]; !done {
+				continue
+			}
+
+			m.logger.Info("reverting migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				if res := tx.Exec(migration.Down); res.Error != nil {
+					return res.Error
+				}
+				return tx.Delete(&SchemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every known migration with the time it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	appliedVersions, err := m.appliedVersions(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if appliedAt, done := appliedVersions[migration.Version]; done {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	return m.db.WithContext(ctx).Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`).Error
+}
+
+func (m *Migrator) appliedVersions(conn *gorm.DB) (map[int64]time.Time, error) {
+	var rows []SchemaMigration
+	if res := conn.Order("version").Find(&rows); res.Error != nil {
+		return nil, res.Error
+	}
+
+	versions := make(map[int64]time.Time, len(rows))
+	for _, row := range rows {
+		versions[row.Version] = row.AppliedAt
+	}
+	return versions, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock, so concurrently starting
+// processes don't apply the same migration twice.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if res := conn.Exec("SELECT pg_advisory_lock(?)", lockId); res.Error != nil {
+			return res.Error
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockId)
+
+		return fn(conn)
+	})
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS artist_discoveries;
+DROP TABLE IF EXISTS artists;
+DROP TABLE IF EXISTS tracks;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS tracks (
+    id         text PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name       text,
+    uri        text,
+    duration   bigint
+);
+CREATE INDEX IF NOT EXISTS idx_tracks_deleted_at ON tracks (deleted_at);
+
+CREATE TABLE IF NOT EXISTS artists (
+    id         text PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name       text,
+    uri        text,
+    genres     text[]
+);
+CREATE INDEX IF NOT EXISTS idx_artists_deleted_at ON artists (deleted_at);
+
+CREATE TABLE IF NOT EXISTS artist_discoveries (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz,
+    artist_name text,
+    track_uri   text CONSTRAINT uni_artist_discoveries_track_uri UNIQUE
+);
+CREATE INDEX IF NOT EXISTS idx_artist_discoveries_deleted_at ON artist_discoveries (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_artist_discoveries_track_uri ON artist_discoveries (track_uri);
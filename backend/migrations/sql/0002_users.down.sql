@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_artist_discoveries_request_id;
+DROP INDEX IF EXISTS idx_artist_discoveries_import_id;
+DROP INDEX IF EXISTS idx_artist_discoveries_user_id;
+ALTER TABLE artist_discoveries DROP COLUMN IF EXISTS request_id;
+ALTER TABLE artist_discoveries DROP COLUMN IF EXISTS import_id;
+ALTER TABLE artist_discoveries DROP COLUMN IF EXISTS user_id;
+
+DROP TABLE IF EXISTS user_tracks;
+DROP TABLE IF EXISTS imports;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS users (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name       text
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name);
+
+CREATE TABLE IF NOT EXISTS imports (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz,
+    user_id     bigint CONSTRAINT fk_imports_user REFERENCES users (id),
+    track_count bigint,
+    request_id  text
+);
+CREATE INDEX IF NOT EXISTS idx_imports_deleted_at ON imports (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_imports_user_id ON imports (user_id);
+
+CREATE TABLE IF NOT EXISTS user_tracks (
+    user_id     bigint,
+    track_uri   text,
+    import_id   bigint,
+    artist_name text,
+    created_at  timestamptz,
+    PRIMARY KEY (user_id, track_uri)
+);
+CREATE INDEX IF NOT EXISTS idx_user_tracks_import_id ON user_tracks (import_id);
+
+ALTER TABLE artist_discoveries ADD COLUMN IF NOT EXISTS user_id bigint;
+ALTER TABLE artist_discoveries ADD COLUMN IF NOT EXISTS import_id bigint;
+ALTER TABLE artist_discoveries ADD COLUMN IF NOT EXISTS request_id text;
+CREATE INDEX IF NOT EXISTS idx_artist_discoveries_user_id ON artist_discoveries (user_id);
+CREATE INDEX IF NOT EXISTS idx_artist_discoveries_import_id ON artist_discoveries (import_id);
+CREATE INDEX IF NOT EXISTS idx_artist_discoveries_request_id ON artist_discoveries (request_id);
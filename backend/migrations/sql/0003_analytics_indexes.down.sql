@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_artist_discoveries_created_at;
+DROP INDEX IF EXISTS idx_artists_genres;
+DROP INDEX IF EXISTS idx_user_tracks_track_uri;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS idx_user_tracks_track_uri ON user_tracks (track_uri);
+CREATE INDEX IF NOT EXISTS idx_artists_genres ON artists USING gin (genres);
+CREATE INDEX IF NOT EXISTS idx_artist_discoveries_created_at ON artist_discoveries (created_at) WHERE deleted_at IS NULL;
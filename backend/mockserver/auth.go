@@ -0,0 +1,110 @@
+package mockserver
+
+import (
+	"backend/spotifyapi"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenStore remembers the issued access tokens until they expire.
+type tokenStore struct {
+	lock   sync.Mutex
+	tokens map[string]time.Time
+}
+
+func (t *tokenStore) issue(token string, expiresIn time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	if t.tokens == nil {
+		t.tokens = make(map[string]time.Time)
+	}
+	for issued, expiry := range t.tokens {
+		if now.After(expiry) {
+			delete(t.tokens, issued)
+		}
+	}
+	t.tokens[token] = now.Add(expiresIn)
+}
+
+// check returns whether token was issued by this server and, if so, whether it expired since.
+func (t *tokenStore) check(token string) (issued bool, expired bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	expiry, issued := t.tokens[token]
+	return issued, issued && time.Now().After(expiry)
+}
+
+// requireToken rejects API requests without a valid bearer token with the error objects of Spotify.
+func (s *Server) requireToken(context *gin.Context) {
+	token, isBearer := strings.CutPrefix(context.GetHeader("Authorization"), "Bearer ")
+	if !isBearer || token == "" {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, spotifyError(http.StatusUnauthorized, "No token provided"))
+		return
+	}
+
+	issued, expired := s.tokens.check(token)
+	if !issued {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, spotifyError(http.StatusUnauthorized, "Invalid access token"))
+		return
+	}
+	if expired {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, spotifyError(http.StatusUnauthorized, "The access token expired"))
+		return
+	}
+
+	context.Next()
+}
+
+// authenticateClient checks a client credentials token request. If ClientID is empty any credentials are
+// accepted, but they still have to be sent.
+func (s *Server) authenticateClient(context *gin.Context) bool {
+	if grantType := context.PostForm("grant_type"); grantType != "client_credentials" {
+		description := "grant_type parameter is missing"
+		if grantType != "" {
+			description = "unsupported grant_type " + grantType
+		}
+		context.JSON(http.StatusBadRequest, authError("unsupported_grant_type", description))
+		return false
+	}
+
+	clientId, clientSecret, hasAuth := context.Request.BasicAuth()
+	if !hasAuth || clientId == "" {
+		context.JSON(http.StatusBadRequest, authError("invalid_client", "Invalid client"))
+		return false
+	}
+	if s.ClientID != "" && clientId != s.ClientID {
+		context.JSON(http.StatusBadRequest, authError("invalid_client", "Invalid client"))
+		return false
+	}
+	if s.ClientID != "" && clientSecret != s.ClientSecret {
+		context.JSON(http.StatusBadRequest, authError("invalid_client", "Invalid client secret"))
+		return false
+	}
+
+	return true
+}
+
+// authError builds the OAuth error object the Spotify accounts service answers token requests with.
+func authError(code string, description string) gin.H {
+	return gin.H{"error": code, "error_description": description}
+}
+
+// fixtureToken returns the access token of a token fixture and its lifetime, empty if it has none. Fixtures
+// without expires_in get the lifetime of generated tokens.
+func fixtureToken(fixture json.RawMessage) (string, time.Duration) {
+	var credentials spotifyapi.ClientCredentials
+	if err := json.Unmarshal(fixture, &credentials); err != nil {
+		return "", 0
+	}
+	if credentials.ExpiresIn.Duration() <= 0 {
+		return credentials.AccessToken, tokenLifetime
+	}
+	return credentials.AccessToken, credentials.ExpiresIn.Duration()
+}
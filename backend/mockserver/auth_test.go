@@ -0,0 +1,51 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFixtureToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		fixture      string
+		wantToken    string
+		wantLifetime time.Duration
+	}{
+		{name: "with expires_in", fixture: `{"access_token":"abc","token_type":"Bearer","expires_in":600}`, wantToken: "abc", wantLifetime: 10 * time.Minute},
+		{name: "without expires_in", fixture: `{"access_token":"abc","token_type":"Bearer"}`, wantToken: "abc", wantLifetime: tokenLifetime},
+		{name: "zero expires_in", fixture: `{"access_token":"abc","expires_in":0}`, wantToken: "abc", wantLifetime: tokenLifetime},
+		{name: "without access_token", fixture: `{"token_type":"Bearer"}`, wantLifetime: tokenLifetime},
+		{name: "not an object", fixture: `[]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, lifetime := fixtureToken(json.RawMessage(test.fixture))
+			if token != test.wantToken {
+				t.Errorf("want token %q, got %q", test.wantToken, token)
+			}
+			if lifetime != test.wantLifetime {
+				t.Errorf("want lifetime %s, got %s", test.wantLifetime, lifetime)
+			}
+		})
+	}
+}
+
+// TestFixtureTokenWithoutExpiry checks that a token fixture without expires_in is accepted after it was issued.
+func TestFixtureTokenWithoutExpiry(t *testing.T) {
+	fixtures := newMemoryFixtures()
+	fixtures.Token = json.RawMessage(`{"access_token":"recorded-token","token_type":"Bearer"}`)
+	router := withoutLatency(t, &Server{Seed: 1, Fixtures: fixtures}).Router()
+
+	token := requestToken(t, router)
+	if token != "recorded-token" {
+		t.Fatalf("want the fixture token, got %q", token)
+	}
+	if status := get(router, "/v1/artists/"+fmt.Sprintf("%022d", 1), token); status != http.StatusOK {
+		t.Errorf("want status %d, got %d", http.StatusOK, status)
+	}
+}
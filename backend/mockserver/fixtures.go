@@ -0,0 +1,156 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	FallbackGenerate = "generate"
+	FallbackNotFound = "not_found"
+
+	tokenFixture = "token.json"
+)
+
+var fixtureKinds = []string{"tracks", "artists", "albums"}
+
+// Fixtures holds recorded Spotify responses, served verbatim instead of generated data. A fixture directory
+// contains tracks/, artists/ and albums/ with one <id>.json per object as returned by the single object
+// endpoints, and optionally token.json with a token response. All directories are optional. Fixtures without a
+// directory, as used when recording without one, are only kept in memory.
+type Fixtures struct {
+	Token json.RawMessage
+
+	dir     string
+	lock    sync.RWMutex
+	objects map[string]map[string]json.RawMessage
+}
+
+// LoadFixtures reads all fixtures of dir into memory and verifies they are valid JSON.
+func LoadFixtures(dir string) (*Fixtures, error) {
+	fixtures := &Fixtures{dir: dir, objects: make(map[string]map[string]json.RawMessage)}
+
+	token, err := readFixture(filepath.Join(dir, tokenFixture))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	fixtures.Token = token
+
+	for _, kind := range fixtureKinds {
+		fixtures.objects[kind] = make(map[string]json.RawMessage)
+
+		entries, err := os.ReadDir(filepath.Join(dir, kind))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures: %w", err)
+		}
+
+		for _, entry := range entries {
+			id, isJson := strings.CutSuffix(entry.Name(), ".json")
+			if entry.IsDir() || !isJson {
+				continue
+			}
+
+			object, err := readFixture(filepath.Join(dir, kind, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			fixtures.objects[kind][id] = object
+		}
+	}
+
+	return fixtures, nil
+}
+
+// newMemoryFixtures returns empty fixtures that are never written to disk.
+func newMemoryFixtures() *Fixtures {
+	fixtures := &Fixtures{objects: make(map[string]map[string]json.RawMessage)}
+	for _, kind := range fixtureKinds {
+		fixtures.objects[kind] = make(map[string]json.RawMessage)
+	}
+	return fixtures
+}
+
+func readFixture(path string) (json.RawMessage, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	if !json.Valid(content) {
+		return nil, fmt.Errorf("fixture %s is not valid JSON", path)
+	}
+	return content, nil
+}
+
+// Get returns the fixture of the given kind, one of tracks, artists and albums, with the given id.
+func (f *Fixtures) Get(kind string, id string) (json.RawMessage, bool) {
+	if f == nil {
+		return nil, false
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	object, exists := f.objects[kind][id]
+	return object, exists
+}
+
+// Save stores object as fixture of the given kind and id, in memory and as file in the fixture directory if
+// there is one.
+func (f *Fixtures) Save(kind string, id string, object json.RawMessage) error {
+	if !json.Valid(object) {
+		return fmt.Errorf("%s %s is not valid JSON", kind, id)
+	}
+
+	if f.dir != "" {
+		if err := f.write(kind, id, object); err != nil {
+			return err
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.objects[kind][id] = object
+	return nil
+}
+
+func (f *Fixtures) write(kind string, id string, object json.RawMessage) error {
+	dir := filepath.Join(f.dir, kind)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to save fixture: %w", err)
+	}
+
+	// written to a temporary file first, so an interrupted write never leaves a truncated fixture behind
+	tmp, err := os.CreateTemp(dir, id+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save fixture: %w", err)
+	}
+	_, err = tmp.Write(object)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, id+".json"))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save fixture: %w", err)
+	}
+	return nil
+}
+
+// Count returns the number of fixtures of the given kind.
+func (f *Fixtures) Count(kind string) int {
+	if f == nil {
+		return 0
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.objects[kind])
+}
@@ -0,0 +1,98 @@
+package mockserver
+
+import (
+	"backend/spotifyapi"
+	"github.com/brianvoe/gofakeit/v7"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	// artistPoolSize bounds the artists tracks are credited to, so tracks share artists like they do on Spotify.
+	artistPoolSize = 1000
+	idLength       = 22
+	idAlphabet     = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// generator derives every entity from the seed and the requested id alone, so the same id always yields the
+// same entity for a given seed, regardless of the order or the number of requests.
+type generator struct {
+	seed uint64
+}
+
+// faker returns a faker whose sequence depends only on the seed, the kind of entity and its id.
+func (g generator) faker(kind string, id string) *gofakeit.Faker {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(kind))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(id))
+	return gofakeit.NewFaker(rand.NewPCG(g.seed, h.Sum64()), false)
+}
+
+// artistId returns the Spotify style base62 id of the artist at index in the pool.
+func (g generator) artistId(index int) string {
+	faker := gofakeit.NewFaker(rand.NewPCG(g.seed, uint64(index)), false)
+	id := make([]byte, idLength)
+	for i := range id {
+		id[i] = idAlphabet[faker.IntN(len(idAlphabet))]
+	}
+	return string(id)
+}
+
+func (g generator) lightweightArtist(id string) spotifyapi.LightweightArtist {
+	faker := g.faker("artist", id)
+	return spotifyapi.LightweightArtist{
+		BaseSpotifyIdentifier: spotifyapi.BaseSpotifyIdentifier{
+			Id:   id,
+			Name: faker.SongArtist(),
+			Uri:  "spotify:artist:" + id,
+		},
+	}
+}
+
+// artist returns the artist with its genres. The genres are drawn independently of the name, so every artist
+// keeps the same genres no matter through which track it was found.
+func (g generator) artist(id string) spotifyapi.Artist {
+	faker := g.faker("genres", id)
+	artist := spotifyapi.Artist{
+		LightweightArtist: g.lightweightArtist(id),
+		Genres:            make([]string, 0),
+	}
+
+	genreCount := faker.IntN(4) + 1
+	for i := 0; i < genreCount; i++ {
+		genre := faker.SongGenre()
+		if !slices.Contains(artist.Genres, genre) {
+			artist.Genres = append(artist.Genres, genre)
+		}
+	}
+	return artist
+}
+
+func (g generator) track(id string) spotifyapi.Track {
+	faker := g.faker("track", id)
+	name := faker.SongName()
+
+	artistCount := faker.IntN(4) + 1
+	artists := make([]spotifyapi.LightweightArtist, 0, artistCount)
+	for i := 0; i < artistCount; i++ {
+		artistId := g.artistId(faker.IntN(artistPoolSize))
+		if !slices.ContainsFunc(artists, func(a spotifyapi.LightweightArtist) bool { return a.Id == artistId }) {
+			artists = append(artists, g.lightweightArtist(artistId))
+		}
+	}
+
+	duration := spotifyapi.MillisecondDuration(time.Duration(faker.IntN(300)+50) * time.Second)
+
+	return spotifyapi.Track{
+		BaseSpotifyIdentifier: spotifyapi.BaseSpotifyIdentifier{
+			Id:   id,
+			Name: name,
+			Uri:  "spotify:track:" + id,
+		},
+		Duration: &duration,
+		Artists:  &artists,
+	}
+}
@@ -1,139 +1,220 @@
 package mockserver
 
 import (
+	"backend/config"
 	"backend/spotifyapi"
 	"fmt"
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"math/rand/v2"
+	"net/http"
+	"slices"
 	"strings"
-	"time"
+	"sync/atomic"
 )
 
+// Server mimics the parts of the Spotify API the backend uses. Objects found in Fixtures are served as
+// recorded, unknown ids are answered according to Fallback. Generated artists and tracks are derived from their
+// id and Seed, so a server started with the same seed always answers with the same data.
 type Server struct {
-	Logger *zap.Logger
-	Port   int
+	Logger   *zap.Logger
+	Port     int
+	Seed     uint64
+	Fixtures *Fixtures
+	// Fallback is FallbackGenerate or FallbackNotFound, empty means FallbackGenerate.
+	Fallback string
+	// Scenarios can be selected by name with SetScenario or at runtime through /_mock/scenario.
+	Scenarios map[string]config.MockScenarioConfig
+	// ClientID and ClientSecret are required to issue tokens, any credentials are accepted if ClientID is empty.
+	ClientID     string
+	ClientSecret string
+	// Upstream, if set, is asked for every object without fixture, the answers are saved to Fixtures. Without
+	// Fixtures the answers are only kept in memory.
+	Upstream *spotifyapi.Client
+
+	scenario atomic.Pointer[scenario]
+	tokens   tokenStore
 }
 
-func (s *Server) RunSpotifyMockServer() error {
-	r := gin.Default()
+// batchLimits are the most ids Spotify accepts per batch request.
+var batchLimits = map[string]int{"tracks": 50, "artists": 50, "albums": 20}
 
+func (s *Server) RunSpotifyMockServer() error {
 	formattedPort := fmt.Sprintf(":%d", s.Port)
-
-	r.POST("/api/token", handlePostToken)
-	r.GET("/v1/artists/:id", handleGetArtist)
-	r.GET("/v1/artists", handleGetArtists)
-	r.GET("/v1/tracks/:id", handleGetTrack)
-	r.GET("/v1/tracks", handleGetTracks)
-
-	return r.Run(formattedPort)
+	return s.Router().Run(formattedPort)
 }
 
-func handlePostToken(context *gin.Context) {
-	duration := spotifyapi.SecondDuration(3600 * time.Second)
-	response := &spotifyapi.ClientCredentials{
-		AccessToken: gofakeit.Password(true, true, true, false, false, 64),
-		TokenType:   "Bearer",
-		ExpiresIn:   duration,
+// Router returns the mock API without listening, e.g. to serve it through httptest. Besides the Spotify
+// endpoints it serves /_mock/scenario to inspect and switch the active scenario. Like Spotify, the API requires
+// a bearer token issued by /api/token and only accepts valid ids.
+func (s *Server) Router() *gin.Engine {
+	if s.Upstream != nil && s.Fixtures == nil {
+		s.logger().Warn("recording without fixture directory, recorded objects are only kept in memory")
+		s.Fixtures = newMemoryFixtures()
 	}
 
-	rndDuration := rand.IntN(5000) + 50
-	<-time.After(time.Duration(rndDuration) * time.Millisecond)
+	r := gin.Default()
 
-	context.JSON(200, response)
-}
+	r.POST("/api/token", s.handlePostToken)
 
-func handleGetArtist(context *gin.Context) {
-	id := context.Param("id")
-	response := generateRndArtist(id)
+	api := r.Group("/v1", s.requireToken)
+	api.GET("/artists/:id", s.handleGetOne("artists", "artist"))
+	api.GET("/artists", s.handleGetMany("artists"))
+	api.GET("/tracks/:id", s.handleGetOne("tracks", "track"))
+	api.GET("/tracks", s.handleGetMany("tracks"))
+	api.GET("/albums/:id", s.handleGetOne("albums", "album"))
+	api.GET("/albums", s.handleGetMany("albums"))
 
-	rndDuration := rand.IntN(5000) + 50
-	<-time.After(time.Duration(rndDuration) * time.Millisecond)
+	r.GET("/_mock/scenario", s.handleGetScenario)
+	r.PUT("/_mock/scenario", s.handlePutScenario)
+	r.PUT("/_mock/scenario/:name", s.handleSelectScenario)
 
-	context.JSON(200, response)
+	return r
 }
 
-func handleGetArtists(context *gin.Context) {
-	rawIds := context.Query("ids")
-	ids := strings.Split(rawIds, ",")
-	artists := make([]spotifyapi.Artist, 0)
-	for _, id := range ids {
-		artists = append(artists, generateRndArtist(id))
+func (s *Server) logger() *zap.Logger {
+	if s.Logger == nil {
+		return zap.NewNop()
 	}
-
-	rndDuration := rand.IntN(5000) + 50
-	<-time.After(time.Duration(rndDuration) * time.Millisecond)
-
-	context.JSON(200, gin.H{"artists": artists})
+	return s.Logger
 }
 
-func generateRndArtist(id string) spotifyapi.Artist {
-	rndGenreCount := rand.IntN(4) + 1
-	rndGenres := make([]string, 0)
-	for i := 0; i < rndGenreCount; i++ {
-		rndGenres = append(rndGenres, gofakeit.SongGenre())
+func (s *Server) handlePostToken(context *gin.Context) {
+	sc := s.activeScenario()
+	sc.delay(context)
+	if sc.injectFault(context, "token") || !s.authenticateClient(context) {
+		return
 	}
-	return spotifyapi.Artist{
-		LightweightArtist: spotifyapi.LightweightArtist{
-			BaseSpotifyIdentifier: spotifyapi.BaseSpotifyIdentifier{
-				Id:   id,
-				Name: gofakeit.SongArtist(),
-				Uri:  gofakeit.UUID(),
-			},
-		},
-		Genres: rndGenres,
+
+	if s.Fixtures != nil && s.Fixtures.Token != nil {
+		if token, expiresIn := fixtureToken(s.Fixtures.Token); token != "" {
+			s.tokens.issue(token, expiresIn)
+		}
+		context.Data(http.StatusOK, "application/json", s.Fixtures.Token)
+		return
 	}
-}
 
-func handleGetTrack(context *gin.Context) {
-	id := context.Param("id")
-	track := generateRndTrack(id)
+	duration := spotifyapi.SecondDuration(sc.tokenExpiresIn())
+	response := &spotifyapi.ClientCredentials{
+		AccessToken: gofakeit.Password(true, true, true, false, false, 64),
+		TokenType:   "Bearer",
+		ExpiresIn:   duration,
+	}
+	s.tokens.issue(response.AccessToken, duration.Duration())
 
-	rndDuration := rand.IntN(5000) + 50
-	<-time.After(time.Duration(rndDuration) * time.Millisecond)
+	context.JSON(http.StatusOK, response)
+}
 
-	context.JSON(200, track)
+// handleGetOne answers a single object request, endpoint names it for fault injection.
+func (s *Server) handleGetOne(kind string, endpoint string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		sc := s.activeScenario()
+		sc.delay(context)
+		if sc.injectFault(context, endpoint) {
+			return
+		}
+
+		id := context.Param("id")
+		if !isSpotifyId(id) {
+			context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, "invalid id"))
+			return
+		}
+
+		if _, exists := s.Fixtures.Get(kind, id); !exists && s.Upstream != nil {
+			s.recordOne(context, kind, id)
+			return
+		}
+
+		object, exists := s.lookup(kind, id)
+		if !exists {
+			context.JSON(http.StatusNotFound, spotifyError(http.StatusNotFound, "non existing id"))
+			return
+		}
+
+		context.JSON(http.StatusOK, object)
+	}
 }
 
-func handleGetTracks(context *gin.Context) {
-	rawIds := context.Query("ids")
-	ids := strings.Split(rawIds, ",")
-	tracks := make([]spotifyapi.Track, 0)
-	for _, id := range ids {
-		tracks = append(tracks, generateRndTrack(id))
+// handleGetMany answers a batch request. Like Spotify it returns null for ids it doesn't know.
+func (s *Server) handleGetMany(kind string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		sc := s.activeScenario()
+		sc.delay(context)
+		if sc.injectFault(context, kind) {
+			return
+		}
+
+		rawIds := context.Query("ids")
+		if rawIds == "" {
+			context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, "Missing required field: ids"))
+			return
+		}
+
+		ids := strings.Split(rawIds, ",")
+		if len(ids) > batchLimits[kind] {
+			context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, "Too many ids requested"))
+			return
+		}
+		if slices.ContainsFunc(ids, func(id string) bool { return !isSpotifyId(id) }) {
+			context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, "invalid id"))
+			return
+		}
+
+		if s.Upstream != nil {
+			if missing := s.missingFixtures(kind, ids); len(missing) > 0 && !s.recordMany(context, kind, missing) {
+				return
+			}
+		}
+
+		objects := make([]any, 0, len(ids))
+		for _, id := range ids {
+			object, exists := s.lookup(kind, id)
+			if !exists || sc.nullEntry(kind) {
+				object = nil
+			}
+			objects = append(objects, object)
+		}
+
+		context.JSON(http.StatusOK, gin.H{kind: objects})
 	}
+}
 
-	rndDuration := rand.IntN(5000) + 50
-	<-time.After(time.Duration(rndDuration) * time.Millisecond)
+// lookup returns the fixture for id or, unless the fallback is FallbackNotFound or responses are recorded, a
+// generated object. Albums are never generated.
+func (s *Server) lookup(kind string, id string) (any, bool) {
+	if fixture, exists := s.Fixtures.Get(kind, id); exists {
+		return fixture, true
+	}
 
-	context.JSON(200, gin.H{"tracks": tracks})
-}
+	if s.Fallback == FallbackNotFound || s.Upstream != nil {
+		return nil, false
+	}
 
-func generateRndTrack(id string) spotifyapi.Track {
-
-	rndArtistCount := rand.IntN(4) + 1
-	var rndArtists []spotifyapi.LightweightArtist
-	for i := 0; i < rndArtistCount; i++ {
-		rndArtists = append(rndArtists, spotifyapi.LightweightArtist{
-			BaseSpotifyIdentifier: spotifyapi.BaseSpotifyIdentifier{
-				Id:   gofakeit.UUID(),
-				Name: gofakeit.Name(),
-				Uri:  gofakeit.UUID(),
-			},
-		})
+	gen := generator{seed: s.Seed}
+	switch kind {
+	case "artists":
+		return gen.artist(id), true
+	case "tracks":
+		return gen.track(id), true
+	default:
+		return nil, false
 	}
+}
 
-	rndDuration := time.Duration(rand.IntN(300)+50) * time.Second
-	duration := spotifyapi.MillisecondDuration(rndDuration)
-
-	return spotifyapi.Track{
-		BaseSpotifyIdentifier: spotifyapi.BaseSpotifyIdentifier{
-			Id:   id,
-			Name: gofakeit.SongName(),
-			Uri:  gofakeit.UUID(),
-		},
-		Duration: &duration,
-		Artists:  &rndArtists,
+// isSpotifyId reports whether id is a base62 Spotify id like 4uLU6hMCjMI75M1A2tKUQC.
+func isSpotifyId(id string) bool {
+	if len(id) != idLength {
+		return false
 	}
+	for i := 0; i < len(id); i++ {
+		if !strings.ContainsRune(idAlphabet, rune(id[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// spotifyError builds the regular error object of the Spotify web API.
+func spotifyError(status int, message string) gin.H {
+	return gin.H{"error": gin.H{"status": status, "message": message}}
 }
@@ -0,0 +1,94 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// forward requests path from the upstream Spotify API. If no response was received the request is answered
+// with 502 and ok is false.
+func (s *Server) forward(context *gin.Context, path string) (status int, body []byte, ok bool) {
+	ctx := context.Request.Context()
+	if err := s.Upstream.Login(ctx); err != nil {
+		s.logger().Error("failed to log in to upstream Spotify API", zap.Error(err))
+		context.JSON(http.StatusBadGateway, spotifyError(http.StatusBadGateway, "upstream login failed"))
+		return 0, nil, false
+	}
+
+	status, body, err := s.Upstream.GetRaw(ctx, path)
+	if err != nil {
+		context.JSON(http.StatusBadGateway, spotifyError(http.StatusBadGateway, "upstream request failed"))
+		return 0, nil, false
+	}
+	return status, body, true
+}
+
+// recordOne forwards a single object request and saves the object if Spotify found it. Any other response is
+// passed on unchanged.
+func (s *Server) recordOne(context *gin.Context, kind string, id string) {
+	status, body, ok := s.forward(context, fmt.Sprintf("/v1/%s/%s", kind, id))
+	if !ok {
+		return
+	}
+
+	if status == http.StatusOK {
+		s.save(kind, id, body)
+	}
+	context.Data(status, "application/json; charset=utf-8", body)
+}
+
+// recordMany forwards a batch request for the ids without fixture and saves every object returned. Unless
+// Spotify answered with 200, its response is passed on and recordMany returns false.
+func (s *Server) recordMany(context *gin.Context, kind string, ids []string) bool {
+	status, body, ok := s.forward(context, fmt.Sprintf("/v1/%s?ids=%s", kind, strings.Join(ids, ",")))
+	if !ok {
+		return false
+	}
+	if status != http.StatusOK {
+		context.Data(status, "application/json; charset=utf-8", body)
+		return false
+	}
+
+	var response map[string][]json.RawMessage
+	if err := json.Unmarshal(body, &response); err != nil {
+		s.logger().Warn("failed to parse upstream response", zap.String("kind", kind), zap.Error(err))
+		context.Data(status, "application/json; charset=utf-8", body)
+		return false
+	}
+
+	for _, object := range response[kind] {
+		var identifier struct {
+			Id string `json:"id"`
+		}
+		// null entries stand for ids Spotify doesn't know
+		if err := json.Unmarshal(object, &identifier); err != nil || identifier.Id == "" {
+			continue
+		}
+		s.save(kind, identifier.Id, object)
+	}
+	return true
+}
+
+// missingFixtures returns the distinct ids without fixture.
+func (s *Server) missingFixtures(kind string, ids []string) []string {
+	var missing []string
+	for _, id := range ids {
+		if _, exists := s.Fixtures.Get(kind, id); !exists && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+func (s *Server) save(kind string, id string, object json.RawMessage) {
+	if err := s.Fixtures.Save(kind, id, object); err != nil {
+		s.logger().Error("failed to record fixture", zap.String("kind", kind), zap.String("id", id), zap.Error(err))
+		return
+	}
+	s.logger().Info("recorded fixture", zap.String("kind", kind), zap.String("id", id))
+}
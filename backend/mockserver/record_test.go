@@ -0,0 +1,98 @@
+package mockserver
+
+import (
+	"backend/config"
+	"backend/spotifyapi"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+}
+
+// TestRecordWithoutFixtures records from an upstream mock without a fixture directory. The recorded objects
+// must be kept in memory and served without asking upstream again.
+func TestRecordWithoutFixtures(t *testing.T) {
+	upstream := httptest.NewServer(withoutLatency(t, &Server{Seed: 1}).Router())
+	t.Cleanup(upstream.Close)
+
+	recorder := withoutLatency(t, &Server{Upstream: spotifyapi.NewSpotifyClient(config.SpotifyConfig{
+		AccountUrl:   upstream.URL,
+		BaseApiUrl:   upstream.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+	}, zap.NewNop())})
+	router := recorder.Router()
+	token := requestToken(t, router)
+
+	trackId := fmt.Sprintf("%022d", 1)
+	for _, path := range []string{"/v1/tracks/" + trackId, "/v1/tracks?ids=" + trackId} {
+		if status := get(router, path, token); status != http.StatusOK {
+			t.Fatalf("GET %s: want status %d, got %d", path, http.StatusOK, status)
+		}
+	}
+
+	if _, exists := recorder.Fixtures.Get("tracks", trackId); !exists {
+		t.Errorf("track %s was not recorded", trackId)
+	}
+
+	upstream.Close()
+	if status := get(router, "/v1/tracks/"+trackId, token); status != http.StatusOK {
+		t.Errorf("recorded track: want status %d without upstream, got %d", http.StatusOK, status)
+	}
+}
+
+// withoutLatency selects a scenario answering immediately on server.
+func withoutLatency(t *testing.T, server *Server) *Server {
+	t.Helper()
+
+	immediate := time.Duration(0)
+	server.Scenarios = map[string]config.MockScenarioConfig{"immediate": {Latency: &config.MockLatencyConfig{Fixed: &immediate}}}
+	if err := server.SetScenario("immediate"); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// requestToken requests a client credentials token from router and returns its access token.
+func requestToken(t *testing.T, router http.Handler) string {
+	t.Helper()
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	request := httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth("client", "secret")
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("token request: want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+
+	var credentials spotifyapi.ClientCredentials
+	if err := json.Unmarshal(recorder.Body.Bytes(), &credentials); err != nil {
+		t.Fatal(err)
+	}
+	return credentials.AccessToken
+}
+
+// get requests path from router with token and returns the response status.
+func get(router http.Handler, path string, token string) int {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder.Code
+}
@@ -0,0 +1,214 @@
+package mockserver
+
+import (
+	"backend/config"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultScenario = "default"
+	// CustomScenario names a scenario posted to the control endpoint instead of selected by name.
+	CustomScenario = "custom"
+
+	defaultMinLatency = 50 * time.Millisecond
+	defaultMaxLatency = 5050 * time.Millisecond
+	defaultRetryAfter = time.Second
+	tokenLifetime     = time.Hour
+)
+
+// ErrUnknownScenario is returned when selecting a scenario that isn't configured.
+var ErrUnknownScenario = errors.New("unknown scenario")
+
+// scenario is the active config.MockScenarioConfig with its name.
+type scenario struct {
+	name string
+	config.MockScenarioConfig
+}
+
+// ScenarioResponse describes the active and the selectable scenarios.
+type ScenarioResponse struct {
+	Active    string   `json:"active"`
+	Available []string `json:"available"`
+}
+
+// SetScenario activates the scenario of Scenarios with the given name, DefaultScenario or an empty name
+// restores the default latency without faults.
+func (s *Server) SetScenario(name string) error {
+	if name == "" || name == DefaultScenario {
+		s.scenario.Store(&scenario{name: DefaultScenario})
+		return nil
+	}
+
+	cfg, exists := s.Scenarios[name]
+	if !exists {
+		return fmt.Errorf("%w %q", ErrUnknownScenario, name)
+	}
+	s.scenario.Store(&scenario{name: name, MockScenarioConfig: cfg})
+	return nil
+}
+
+func (s *Server) activeScenario() *scenario {
+	if active := s.scenario.Load(); active != nil {
+		return active
+	}
+	return &scenario{name: DefaultScenario}
+}
+
+func (s *Server) scenarioResponse() ScenarioResponse {
+	available := append([]string{DefaultScenario}, slices.Sorted(maps.Keys(s.Scenarios))...)
+	return ScenarioResponse{Active: s.activeScenario().name, Available: available}
+}
+
+func (s *Server) handleGetScenario(context *gin.Context) {
+	context.JSON(http.StatusOK, s.scenarioResponse())
+}
+
+func (s *Server) handleSelectScenario(context *gin.Context) {
+	name := context.Param("name")
+	if err := s.SetScenario(name); err != nil {
+		context.JSON(http.StatusNotFound, spotifyError(http.StatusNotFound, err.Error()))
+		return
+	}
+
+	s.logger().Info("switched mock server scenario", zap.String("scenario", name))
+	context.JSON(http.StatusOK, s.scenarioResponse())
+}
+
+// handlePutScenario activates the scenario in the request body, which uses the same fields as the config file
+// and may be given as JSON or YAML.
+func (s *Server) handlePutScenario(context *gin.Context) {
+	body, err := io.ReadAll(context.Request.Body)
+	if err != nil {
+		context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	var cfg config.MockScenarioConfig
+	if err = yaml.Unmarshal(body, &cfg); err != nil {
+		context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err = cfg.Validate(); err != nil {
+		context.JSON(http.StatusBadRequest, spotifyError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	s.scenario.Store(&scenario{name: CustomScenario, MockScenarioConfig: cfg})
+	s.logger().Info("switched mock server scenario", zap.String("scenario", CustomScenario))
+	context.JSON(http.StatusOK, s.scenarioResponse())
+}
+
+// delay sleeps for a latency drawn from the scenario or returns early once the request is cancelled.
+func (sc *scenario) delay(context *gin.Context) {
+	timer := time.NewTimer(sc.latency())
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-context.Request.Context().Done():
+	}
+}
+
+func (sc *scenario) latency() time.Duration {
+	latency := sc.Latency
+	switch {
+	case latency == nil:
+		return uniform(defaultMinLatency, defaultMaxLatency)
+	case latency.Fixed != nil:
+		return *latency.Fixed
+	case latency.P50 != 0 || latency.P90 != 0 || latency.P99 != 0:
+		return percentile(rand.Float64(), latency.P50, latency.P90, latency.P99)
+	default:
+		return uniform(latency.Min, latency.Max)
+	}
+}
+
+func uniform(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + rand.N(max-min)
+}
+
+// percentile interpolates linearly between 0, the given percentiles and p99, which also serves as maximum.
+func percentile(q float64, p50 time.Duration, p90 time.Duration, p99 time.Duration) time.Duration {
+	points := []struct {
+		q       float64
+		latency time.Duration
+	}{{0, 0}, {0.5, p50}, {0.9, p90}, {0.99, p99}, {1, p99}}
+
+	for i := 1; i < len(points); i++ {
+		lower, upper := points[i-1], points[i]
+		if q <= upper.q {
+			fraction := (q - lower.q) / (upper.q - lower.q)
+			return lower.latency + time.Duration(fraction*float64(upper.latency-lower.latency))
+		}
+	}
+	return p99
+}
+
+// faults returns the faults configured for endpoint, falling back to those for all endpoints.
+func (sc *scenario) faults(endpoint string) config.MockFaultsConfig {
+	if faults, exists := sc.Faults[endpoint]; exists {
+		return faults
+	}
+	return sc.Faults["*"]
+}
+
+func (sc *scenario) tokenExpiresIn() time.Duration {
+	if sc.TokenExpiresIn != nil {
+		return *sc.TokenExpiresIn
+	}
+	return tokenLifetime
+}
+
+// injectFault answers the request with at most one of the configured faults and reports whether it did.
+func (sc *scenario) injectFault(context *gin.Context, endpoint string) bool {
+	faults := sc.faults(endpoint)
+	roll := rand.Float64()
+
+	if roll -= faults.InternalError; roll < 0 {
+		context.JSON(http.StatusInternalServerError, spotifyError(http.StatusInternalServerError, "Server error"))
+		return true
+	}
+	if roll -= faults.BadGateway; roll < 0 {
+		context.JSON(http.StatusBadGateway, spotifyError(http.StatusBadGateway, "Bad gateway"))
+		return true
+	}
+	if roll -= faults.ExpiredToken; roll < 0 {
+		context.JSON(http.StatusUnauthorized, spotifyError(http.StatusUnauthorized, "The access token expired"))
+		return true
+	}
+	if roll -= faults.RateLimited; roll < 0 {
+		retryAfter := faults.RetryAfter
+		if retryAfter == 0 {
+			retryAfter = defaultRetryAfter
+		}
+		seconds := int((retryAfter + time.Second - 1) / time.Second)
+		context.Header("Retry-After", strconv.Itoa(seconds))
+		context.JSON(http.StatusTooManyRequests, spotifyError(http.StatusTooManyRequests, "API rate limit exceeded"))
+		return true
+	}
+	if roll -= faults.MalformedJson; roll < 0 {
+		context.Data(http.StatusOK, "application/json; charset=utf-8", []byte(`{"`+endpoint+`": [{"id": "`))
+		return true
+	}
+	return false
+}
+
+// nullEntry reports whether a batch entry should be replaced by null.
+func (sc *scenario) nullEntry(endpoint string) bool {
+	probability := sc.faults(endpoint).NullEntries
+	return probability > 0 && rand.Float64() < probability
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"backend/config"
+	"backend/discovery"
+	"backend/spotifyapi"
+	"context"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const configPollInterval = 5 * time.Second
+
+// liveFields are applied to the running process on reload, changes to any other field need a restart.
+var liveFields = []string{
+	"logging.level",
+	"logging.components",
+	"logging.sinks",
+	"logging.sinks.console",
+	"logging.sinks.file",
+	"logging.sinks.json",
+	"discover.batch_size",
+	"discover.retry_interval",
+	"spotify.retry_count",
+	"spotify.retry_wait_time",
+	"spotify.time_out",
+}
+
+// reconfigurable is implemented by spotify clients able to swap their http settings at runtime.
+type reconfigurable interface {
+	Reconfigure(config config.SpotifyConfig)
+}
+
+// watchConfig reloads the config file when it changes or SIGHUP is received, until ctx is done. worker and
+// spotifyClient may be nil for commands not running them.
+func (app *application) watchConfig(ctx context.Context, worker *discovery.DiscoverWorker, spotifyClient spotifyapi.SpotifyClient) {
+	watcher := config.NewWatcher(
+		app.configPath,
+		app.overrides,
+		app.requiredSections,
+		app.live.Load(),
+		func(previous, updated *config.Config) {
+			app.applyConfig(previous, updated, worker, spotifyClient)
+		},
+		func(err error) {
+			app.logger.Error("config reload failed, keeping the current config", zap.Error(err))
+		},
+	)
+
+	go watcher.Run(ctx, configPollInterval)
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangups)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+				app.logger.Info("received SIGHUP, reloading config")
+				watcher.Reload()
+			}
+		}
+	}()
+}
+
+func (app *application) applyConfig(previous, updated *config.Config, worker *discovery.DiscoverWorker, spotifyClient spotifyapi.SpotifyClient) {
+	var applied, restartRequired []string
+	for _, field := range config.Diff(previous, updated) {
+		if slices.Contains(liveFields, field) {
+			applied = append(applied, field)
+		} else {
+			restartRequired = append(restartRequired, field)
+		}
+	}
+
+	// logged before applying, so lowering the log level doesn't hide what changed
+	if len(applied) > 0 {
+		app.logger.Info("applying config changes", zap.Strings("fields", applied))
+	}
+	if len(restartRequired) > 0 {
+		app.logger.Warn("config changes require a restart to take effect", zap.Strings("fields", restartRequired))
+	}
+
+	app.live.Store(updated)
+
+	spotifyChanged := false
+	for _, field := range applied {
+		switch {
+		case strings.HasPrefix(field, "logging."):
+			if err := app.logging.Apply(updated.Logging); err != nil {
+				app.logger.Error("failed to apply log levels", zap.Error(err))
+			}
+		case field == "discover.batch_size" && worker != nil:
+			worker.SetBatchSize(updated.DiscoverConfig.BatchSize)
+		case strings.HasPrefix(field, "spotify."):
+			spotifyChanged = true
+		}
+	}
+
+	if client, ok := spotifyClient.(reconfigurable); ok && spotifyChanged && updated.SpotifyConfig != nil {
+		client.Reconfigure(*updated.SpotifyConfig)
+	}
+}
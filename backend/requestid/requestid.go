@@ -0,0 +1,39 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+var validId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Generate returns a new random request id.
+func Generate() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// IsValid reports whether an id supplied by a client is safe to log and to pass on.
+func IsValid(id string) bool {
+	return validId.MatchString(id)
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id stored in ctx or an empty string.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -2,11 +2,17 @@ package spotifyapi
 
 import (
 	"backend/config"
+	"backend/metrics"
+	"backend/requestid"
+	"context"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,16 +23,33 @@ type Client struct {
 	ClientSecret string
 	Logger       *zap.Logger
 
-	client          *resty.Client
+	clientLock sync.RWMutex
+	client     *resty.Client
+	// accessToken is attached to every request but token requests, see authorize.
+	accessToken     string
+	loginLock       sync.Mutex
 	loginExpiration time.Time
+
+	statusLock  sync.RWMutex
+	loginStatus LoginStatus
+}
+
+// LoginStatus describes the outcome of the most recent token generation.
+type LoginStatus struct {
+	Enabled     bool
+	LastAttempt time.Time
+	LastSuccess time.Time
+	ExpiresAt   time.Time
+	LastError   error
 }
 
 type SpotifyClient interface {
-	Login() error
-	GetArtist(id string) (*Artist, error)
-	GetArtists(ids []string) ([]Artist, error)
-	GetTrack(id string) (*Track, error)
-	GetTracks(ids []string) ([]Track, error)
+	Login(ctx context.Context) error
+	GetArtist(ctx context.Context, id string) (*Artist, error)
+	GetArtists(ctx context.Context, ids []string) ([]Artist, error)
+	GetTrack(ctx context.Context, id string) (*Track, error)
+	GetTracks(ctx context.Context, ids []string) ([]Track, error)
+	LoginStatus() LoginStatus
 }
 
 var (
@@ -44,6 +67,7 @@ func NewSpotifyClient(config config.SpotifyConfig, logger *zap.Logger) *Client {
 		ClientId:     config.ClientID,
 		ClientSecret: config.ClientSecret,
 		Logger:       logger,
+		loginStatus:  LoginStatus{Enabled: true},
 	}
 
 	client := sClient.buildRestyClient(config, logger)
@@ -52,55 +76,73 @@ func NewSpotifyClient(config config.SpotifyConfig, logger *zap.Logger) *Client {
 	return sClient
 }
 
-func (c *Client) Login() error {
-	if time.Now().Before(c.loginExpiration) {
-		c.Logger.Info("Login still valid, no need to login")
+// Login generates a client credentials token unless the current one is still valid. Concurrent callers wait
+// for a single token request instead of racing to replace the token.
+func (c *Client) Login(ctx context.Context) error {
+	return c.login(ctx, "")
+}
+
+// login generates a token like Login. A rejected token, one Spotify answered with 401, is replaced even
+// before it expires, unless another caller already replaced it.
+func (c *Client) login(ctx context.Context, rejectedToken string) error {
+	c.loginLock.Lock()
+	defer c.loginLock.Unlock()
+
+	logger := c.loggerFor(ctx)
+	if time.Now().Before(c.loginExpiration) && (rejectedToken == "" || rejectedToken != c.token()) {
+		logger.Info("Login still valid, no need to login")
 		return nil
 	}
 
-	c.Logger.Info("Generation Spotify token for requests")
+	logger.Info("Generation Spotify token for requests")
 	formData := map[string]string{
 		"grant_type": "client_credentials",
 	}
 
 	loginUrl := fmt.Sprintf("%s%s", c.AccountUrl, tokenEndpoint)
 
-	resp, err := c.client.R().
+	resp, err := c.request(ctx).
 		SetFormData(formData).
 		SetBasicAuth(c.ClientId, c.ClientSecret).
 		SetResult(&ClientCredentials{}).
 		Post(loginUrl)
 
 	if err != nil {
-		responseErrorLogger(resp, err, c.Logger).Error(
+		responseErrorLogger(ctx, resp, err, c.Logger).Error(
 			"Error during Spotify Token generation",
 		)
+		c.recordLogin(err)
 		return err
 	}
 
 	parsedResponse := resp.Result().(*ClientCredentials)
-	c.loginExpiration = time.Now().Add(time.Duration(parsedResponse.ExpiresIn) * time.Second)
-	c.Logger.Info(
+	c.loginExpiration = time.Now().Add(parsedResponse.ExpiresIn.Duration())
+	metrics.SpotifyTokenExpiry.Set(float64(c.loginExpiration.Unix()))
+	c.recordLogin(nil)
+	logger.Info(
 		"Successfully generated token, setting auth info.",
 		zap.Duration("expires_in", parsedResponse.ExpiresIn.Duration()),
 	)
-	c.client.SetAuthScheme("Bearer").SetAuthToken(parsedResponse.AccessToken)
+	c.clientLock.Lock()
+	c.accessToken = parsedResponse.AccessToken
+	c.clientLock.Unlock()
 
 	return nil
 }
 
-func (c *Client) GetArtist(id string) (*Artist, error) {
-	c.Logger.Info("Getting artist", zap.String("id", id))
+func (c *Client) GetArtist(ctx context.Context, id string) (*Artist, error) {
+	logger := c.loggerFor(ctx)
+	logger.Info("Getting artist", zap.String("id", id))
 
 	formattedEndpoint := fmt.Sprintf(artistEndpoint, id)
 	artistUrl := fmt.Sprintf("%s%s", c.BaseApiUrl, formattedEndpoint)
 
-	resp, err := c.client.R().
+	resp, err := c.request(ctx).
 		SetResult(&Artist{}).
 		Get(artistUrl)
 
 	if err != nil {
-		responseErrorLogger(resp, err, c.Logger).Error(
+		responseErrorLogger(ctx, resp, err, c.Logger).Error(
 			"Error while getting artist",
 			zap.String("id", id),
 		)
@@ -108,7 +150,7 @@ func (c *Client) GetArtist(id string) (*Artist, error) {
 	}
 
 	artist := resp.Result().(*Artist)
-	c.Logger.Info(
+	logger.Info(
 		"Successfully received artist",
 		zap.String("id", id),
 		zap.String("artist_name", artist.Name),
@@ -117,18 +159,19 @@ func (c *Client) GetArtist(id string) (*Artist, error) {
 	return artist, nil
 }
 
-func (c *Client) GetArtists(ids []string) ([]Artist, error) {
-	c.Logger.Info("Getting artists", zap.Strings("ids", ids))
+func (c *Client) GetArtists(ctx context.Context, ids []string) ([]Artist, error) {
+	logger := c.loggerFor(ctx)
+	logger.Info("Getting artists", zap.Strings("ids", ids))
 
 	formattedEndpoint := fmt.Sprintf(artistsEndpoint, strings.Join(ids, ","))
 	artistsUrl := fmt.Sprintf("%s%s", c.BaseApiUrl, formattedEndpoint)
 
-	resp, err := c.client.R().
+	resp, err := c.request(ctx).
 		SetResult(&ArtistsResponse{}).
 		Get(artistsUrl)
 
 	if err != nil {
-		responseErrorLogger(resp, err, c.Logger).Error(
+		responseErrorLogger(ctx, resp, err, c.Logger).Error(
 			"Error while getting artists",
 			zap.Strings("ids", ids),
 		)
@@ -137,7 +180,7 @@ func (c *Client) GetArtists(ids []string) ([]Artist, error) {
 	}
 
 	artists := resp.Result().(*ArtistsResponse).Artists
-	c.Logger.Info(
+	logger.Info(
 		"Successfully received artists",
 		zap.Strings("ids", ids),
 		zap.Int("artists_count", len(artists)),
@@ -146,18 +189,19 @@ func (c *Client) GetArtists(ids []string) ([]Artist, error) {
 	return artists, nil
 }
 
-func (c *Client) GetTrack(id string) (*Track, error) {
-	c.Logger.Info("Getting track", zap.String("id", id))
+func (c *Client) GetTrack(ctx context.Context, id string) (*Track, error) {
+	logger := c.loggerFor(ctx)
+	logger.Info("Getting track", zap.String("id", id))
 
 	formattedEndpoint := fmt.Sprintf(trackEndpoint, id)
 	trackUrl := fmt.Sprintf("%s%s", c.BaseApiUrl, formattedEndpoint)
 
-	resp, err := c.client.R().
+	resp, err := c.request(ctx).
 		SetResult(&Track{}).
 		Get(trackUrl)
 
 	if err != nil {
-		responseErrorLogger(resp, err, c.Logger).Error(
+		responseErrorLogger(ctx, resp, err, c.Logger).Error(
 			"Error while getting track",
 			zap.String("id", id),
 		)
@@ -165,7 +209,7 @@ func (c *Client) GetTrack(id string) (*Track, error) {
 	}
 
 	track := resp.Result().(*Track)
-	c.Logger.Info(
+	logger.Info(
 		"Successfully received track",
 		zap.String("id", id),
 		zap.String("track_name", track.Name),
@@ -174,18 +218,19 @@ func (c *Client) GetTrack(id string) (*Track, error) {
 	return track, nil
 }
 
-func (c *Client) GetTracks(ids []string) ([]Track, error) {
-	c.Logger.Info("Getting tracks", zap.Strings("ids", ids))
+func (c *Client) GetTracks(ctx context.Context, ids []string) ([]Track, error) {
+	logger := c.loggerFor(ctx)
+	logger.Info("Getting tracks", zap.Strings("ids", ids))
 
 	formattedEndpoint := fmt.Sprintf(tracksEndpoint, strings.Join(ids, ","))
 	tracksUrl := fmt.Sprintf("%s%s", c.BaseApiUrl, formattedEndpoint)
 
-	resp, err := c.client.R().
+	resp, err := c.request(ctx).
 		SetResult(&TracksResponse{}).
 		Get(tracksUrl)
 
 	if err != nil {
-		responseErrorLogger(resp, err, c.Logger).Error(
+		responseErrorLogger(ctx, resp, err, c.Logger).Error(
 			"Error while getting tracks",
 			zap.Strings("ids", ids),
 		)
@@ -194,7 +239,7 @@ func (c *Client) GetTracks(ids []string) ([]Track, error) {
 	}
 
 	tracks := resp.Result().(*TracksResponse).Tracks
-	c.Logger.Info("Successfully received tracks",
+	logger.Info("Successfully received tracks",
 		zap.Strings("ids", ids),
 		zap.Int("tracks_count", len(tracks)),
 	)
@@ -202,11 +247,83 @@ func (c *Client) GetTracks(ids []string) ([]Track, error) {
 	return tracks, nil
 }
 
-func responseErrorLogger(resp *resty.Response, err error, baseLogger *zap.Logger) *zap.Logger {
+// GetRaw requests path of the API, e.g. /v1/tracks?ids=..., and returns status and body as received. Unlike the
+// typed getters it only fails if no response was received at all.
+func (c *Client) GetRaw(ctx context.Context, path string) (int, []byte, error) {
+	resp, err := c.request(ctx).Get(c.BaseApiUrl + path)
+	if resp == nil || resp.RawResponse == nil {
+		responseErrorLogger(ctx, resp, err, c.Logger).Error("Error while forwarding request", zap.String("path", path))
+		return 0, nil, err
+	}
+
+	return resp.StatusCode(), resp.Body(), nil
+}
+
+func (c *Client) LoginStatus() LoginStatus {
+	c.statusLock.RLock()
+	defer c.statusLock.RUnlock()
+	return c.loginStatus
+}
+
+func (c *Client) recordLogin(err error) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	now := time.Now()
+	c.loginStatus.Enabled = true
+	c.loginStatus.LastAttempt = now
+	c.loginStatus.LastError = err
+	if err == nil {
+		c.loginStatus.LastSuccess = now
+		c.loginStatus.ExpiresAt = c.loginExpiration
+	}
+}
+
+// Reconfigure swaps in a resty client built with the updated retry and timeout settings, keeping the current
+// token. Requests already in flight finish on the previous client.
+func (c *Client) Reconfigure(config config.SpotifyConfig) {
+	client := c.buildRestyClient(config, c.Logger)
+
+	c.clientLock.Lock()
+	defer c.clientLock.Unlock()
+	c.client = client
+}
+
+func (c *Client) token() string {
+	c.clientLock.RLock()
+	defer c.clientLock.RUnlock()
+	return c.accessToken
+}
+
+// request prepares a resty request bound to ctx, forwarding the request id of the API call that caused it.
+func (c *Client) request(ctx context.Context) *resty.Request {
+	c.clientLock.RLock()
+	client := c.client
+	c.clientLock.RUnlock()
+
+	req := client.R().SetContext(ctx)
+	if id := requestid.FromContext(ctx); id != "" {
+		req = req.SetHeader(requestid.Header, id)
+	}
+	return req
+}
+
+func (c *Client) loggerFor(ctx context.Context) *zap.Logger {
+	if id := requestid.FromContext(ctx); id != "" {
+		return c.Logger.With(zap.String("request_id", id))
+	}
+	return c.Logger
+}
+
+func responseErrorLogger(ctx context.Context, resp *resty.Response, err error, baseLogger *zap.Logger) *zap.Logger {
 	modifiedLogger := baseLogger.With(
 		zap.Error(err),
 	)
 
+	if id := requestid.FromContext(ctx); id != "" {
+		modifiedLogger = modifiedLogger.With(zap.String("request_id", id))
+	}
+
 	if resp != nil {
 		modifiedLogger = modifiedLogger.With(
 			zap.Int("status_code", resp.StatusCode()),
@@ -221,9 +338,11 @@ func responseErrorLogger(resp *resty.Response, err error, baseLogger *zap.Logger
 
 func (c *Client) buildRestyClient(config config.SpotifyConfig, logger *zap.Logger) *resty.Client {
 	client := resty.New().
+		SetTransport(otelhttp.NewTransport(http.DefaultTransport)).
 		SetLogger(logger.Sugar()).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("Accept", "application/json").
+		OnBeforeRequest(c.authorize).
 		OnAfterResponse(c.handleAnyResponse)
 
 	buildLogger := logger.With()
@@ -265,8 +384,14 @@ func (c *Client) buildRestyClient(config config.SpotifyConfig, logger *zap.Logge
 			}
 
 			if response.StatusCode() == http.StatusUnauthorized {
+				// the token request itself holds the login lock, logging in again would deadlock
+				if strings.HasSuffix(response.Request.RawRequest.URL.Path, tokenEndpoint) {
+					logger.Warn("Spotify API - Token request unauthorized, do not retry")
+					return false
+				}
 				logger.Warn("Spotify API - Unauthorized, attempt relogin and retry operation")
-				loginErr := c.Login()
+				rejectedToken := strings.TrimPrefix(response.Request.RawRequest.Header.Get("Authorization"), "Bearer ")
+				loginErr := c.login(response.Request.Context(), rejectedToken)
 				if loginErr != nil {
 					logger.Warn("Spotify API - Login failed, do not retry", zap.Error(loginErr))
 					return false
@@ -287,6 +412,15 @@ func (c *Client) buildRestyClient(config config.SpotifyConfig, logger *zap.Logge
 	return client
 }
 
+// authorize attaches the current token to API requests. It runs before every attempt, so a request retried
+// after a relogin carries the new token. Token requests keep their basic auth, which a token would replace.
+func (c *Client) authorize(_ *resty.Client, request *resty.Request) error {
+	if request.UserInfo == nil {
+		request.SetAuthScheme("Bearer").SetAuthToken(c.token())
+	}
+	return nil
+}
+
 func (c *Client) handleAnyResponse(client *resty.Client, response *resty.Response) error {
 	var err error
 	logLevel := zap.InfoLevel
@@ -305,11 +439,20 @@ func (c *Client) handleAnyResponse(client *resty.Client, response *resty.Respons
 		logLevel = zap.ErrorLevel
 	}
 
+	endpoint := metrics.SpotifyEndpoint(response.Request.RawRequest.URL.Path)
+	metrics.SpotifyRequests.
+		WithLabelValues(response.Request.Method, endpoint, strconv.Itoa(response.StatusCode())).
+		Inc()
+	metrics.SpotifyRequestDuration.
+		WithLabelValues(response.Request.Method, endpoint).
+		Observe(response.Time().Seconds())
+
 	c.Logger.With(
 		zap.Int("response_status_code", response.StatusCode()),
 		zap.String("request_method", response.Request.Method),
 		zap.String("request_url", response.Request.URL),
 		zap.Duration("duration", response.Time()),
+		zap.String("request_id", requestid.FromContext(response.Request.Context())),
 	).Log(logLevel, "Spotify API response")
 
 	return err
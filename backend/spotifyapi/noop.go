@@ -1,32 +1,39 @@
 package spotifyapi
 
-import "go.uber.org/zap"
+import (
+	"context"
+	"go.uber.org/zap"
+)
 
 type NoopClient struct {
 	Logger *zap.Logger
 }
 
-func (n *NoopClient) Login() error {
+func (n *NoopClient) Login(ctx context.Context) error {
 	n.Logger.Info("Noop: Logging in")
 	return nil
 }
 
-func (n *NoopClient) GetArtist(id string) (*Artist, error) {
+func (n *NoopClient) GetArtist(ctx context.Context, id string) (*Artist, error) {
 	n.Logger.Info("Noop: Getting artist", zap.String("id", id))
 	return nil, nil
 }
 
-func (n *NoopClient) GetArtists(ids []string) ([]Artist, error) {
+func (n *NoopClient) GetArtists(ctx context.Context, ids []string) ([]Artist, error) {
 	n.Logger.Info("Noop: Getting artists")
 	return nil, nil
 }
 
-func (n *NoopClient) GetTrack(id string) (*Track, error) {
+func (n *NoopClient) GetTrack(ctx context.Context, id string) (*Track, error) {
 	n.Logger.Info("Noop: Getting track", zap.String("id", id))
 	return nil, nil
 }
 
-func (n *NoopClient) GetTracks(ids []string) ([]Track, error) {
+func (n *NoopClient) GetTracks(ctx context.Context, ids []string) ([]Track, error) {
 	n.Logger.Info("Noop: Getting tracks")
 	return nil, nil
 }
+
+func (n *NoopClient) LoginStatus() LoginStatus {
+	return LoginStatus{}
+}
@@ -1,16 +1,130 @@
 package stripper
 
 import (
+	"bytes"
 	"io"
-	"regexp"
+	"sync"
 )
 
+const (
+	esc = 0x1b
+	bel = 0x07
+	can = 0x18
+	sub = 0x1a
+)
+
+type state uint8
+
+const (
+	stateGround state = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCsi
+	stateString
+	stateStringEscape
+)
+
+// StripColorWriter removes ANSI escape sequences, CSI sequences like colors or cursor movement as well as OSC,
+// DCS, SOS, PM and APC strings, before writing to W. The parser state survives between writes, so sequences
+// split across Write calls are removed too. It is safe for concurrent use.
 type StripColorWriter struct {
 	W io.Writer
+
+	lock  sync.Mutex
+	state state
+	buf   []byte
 }
 
+// Write reports len(p) on success as required by io.Writer, even though fewer bytes reach W.
 func (s *StripColorWriter) Write(p []byte) (n int, err error) {
-	re := regexp.MustCompile(`\x1b\[[0-9;]*m`)
-	clean := re.ReplaceAll(p, []byte(""))
-	return s.W.Write(clean)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.state == stateGround && bytes.IndexByte(p, esc) < 0 {
+		return s.W.Write(p)
+	}
+
+	s.buf = s.strip(s.buf[:0], p)
+	if len(s.buf) > 0 {
+		if _, err = s.W.Write(s.buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// strip appends the printable bytes of p to dst, advancing the parser state.
+func (s *StripColorWriter) strip(dst []byte, p []byte) []byte {
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+		switch s.state {
+		case stateGround:
+			next := bytes.IndexByte(p[i:], esc)
+			if next < 0 {
+				return append(dst, p[i:]...)
+			}
+			dst = append(dst, p[i:i+next]...)
+			i += next
+			s.state = stateEscape
+		case stateEscape:
+			switch {
+			case b == can || b == sub:
+				s.state = stateGround
+			case b < 0x20 && b != esc:
+				dst = append(dst, b)
+			default:
+				s.state = escapeState(b)
+			}
+		case stateEscapeIntermediate:
+			switch {
+			case b == esc:
+				s.state = stateEscape
+			case b >= 0x20 && b <= 0x2f:
+			default:
+				s.state = stateGround
+			}
+		case stateCsi:
+			switch {
+			case b == esc:
+				s.state = stateEscape
+			case b == can || b == sub:
+				s.state = stateGround
+			case b >= 0x40 && b <= 0x7e:
+				s.state = stateGround
+			case b < 0x20:
+				// C0 controls inside a sequence are still executed by terminals, keep them
+				dst = append(dst, b)
+			}
+		case stateString:
+			switch b {
+			case esc:
+				s.state = stateStringEscape
+			case bel, can, sub:
+				s.state = stateGround
+			}
+		case stateStringEscape:
+			if b == '\\' {
+				s.state = stateGround
+			} else {
+				s.state = escapeState(b)
+			}
+		}
+	}
+	return dst
+}
+
+// escapeState returns the state following ESC b.
+func escapeState(b byte) state {
+	switch {
+	case b == '[':
+		return stateCsi
+	case b == ']' || b == 'P' || b == 'X' || b == '^' || b == '_':
+		return stateString
+	case b == esc:
+		return stateEscape
+	case b >= 0x20 && b <= 0x2f:
+		return stateEscapeIntermediate
+	default:
+		return stateGround
+	}
 }
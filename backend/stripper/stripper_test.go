@@ -0,0 +1,143 @@
+package stripper
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+var stripTests = []struct {
+	name  string
+	input string
+	want  string
+}{
+	{name: "plain text", input: "GET /api/v1/discover 200\n", want: "GET /api/v1/discover 200\n"},
+	{name: "sgr colors", input: "\x1b[97;42m 200 \x1b[0m| GET", want: " 200 | GET"},
+	{name: "sgr without parameters", input: "\x1b[mreset", want: "reset"},
+	{name: "cursor movement", input: "a\x1b[2Ab\x1b[10;20Hc", want: "abc"},
+	{name: "erase line", input: "progress\x1b[2K\rdone", want: "progress\rdone"},
+	{name: "private mode", input: "\x1b[?25lhidden cursor\x1b[?25h", want: "hidden cursor"},
+	{name: "osc terminated by bel", input: "\x1b]0;window title\x07text", want: "text"},
+	{name: "osc terminated by st", input: "\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", want: "link"},
+	{name: "dcs string", input: "\x1bPq#0;2;0;0;0\x1b\\after", want: "after"},
+	{name: "csi aborted by can", input: "\x1b[31\x18text", want: "text"},
+	{name: "csi aborted by sub", input: "\x1b[31\x1atext", want: "text"},
+	{name: "osc aborted by can", input: "\x1b]0;title\x18text", want: "text"},
+	{name: "escape aborted by sub", input: "\x1b\x1atext", want: "text"},
+	{name: "c0 control inside csi", input: "\x1b[3\n1mtext", want: "\ntext"},
+	{name: "escape restarts csi", input: "\x1b[31\x1b[32mtext", want: "text"},
+	{name: "two character escape", input: "\x1b7saved\x1b8", want: "saved"},
+	{name: "charset designation", input: "\x1b(Btext", want: "text"},
+	{name: "utf-8 is kept", input: "\x1b[1mgrüße ✓\x1b[0m", want: "grüße ✓"},
+}
+
+func TestWrite(t *testing.T) {
+	for _, test := range stripTests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writer := &StripColorWriter{W: &out}
+
+			n, err := writer.Write([]byte(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(test.input) {
+				t.Errorf("want n = %d, got %d", len(test.input), n)
+			}
+			if out.String() != test.want {
+				t.Errorf("want %q, got %q", test.want, out.String())
+			}
+		})
+	}
+}
+
+func TestWriteSplitSequences(t *testing.T) {
+	for _, test := range stripTests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			writer := &StripColorWriter{W: &out}
+
+			for i := 0; i < len(test.input); i++ {
+				if _, err := writer.Write([]byte{test.input[i]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out.String() != test.want {
+				t.Errorf("want %q, got %q", test.want, out.String())
+			}
+		})
+	}
+}
+
+func TestWriteDoesNotAllocate(t *testing.T) {
+	line := []byte("\x1b[90m[GIN]\x1b[0m 2024/01/01 - 12:00:00 |\x1b[97;42m 200 \x1b[0m| 1.2ms | GET /api/v1/discover\n")
+	writer := &StripColorWriter{W: io.Discard}
+	_, _ = writer.Write(line)
+
+	if allocs := testing.AllocsPerRun(100, func() { _, _ = writer.Write(line) }); allocs != 0 {
+		t.Errorf("want no allocations per write, got %.1f", allocs)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	benchmarks := []struct {
+		name string
+		line string
+	}{
+		{name: "plain", line: "[GIN] 2024/01/01 - 12:00:00 | 200 | 1.2ms | 127.0.0.1 | GET /api/v1/discover\n"},
+		{name: "colored", line: "\x1b[90m[GIN]\x1b[0m 2024/01/01 - 12:00:00 |\x1b[97;42m 200 \x1b[0m| 1.2ms | 127.0.0.1 |\x1b[97;44m GET \x1b[0m /api/v1/discover\n"},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			line := []byte(benchmark.line)
+			writer := &StripColorWriter{W: io.Discard}
+			b.SetBytes(int64(len(line)))
+			b.ReportAllocs()
+			for b.Loop() {
+				_, _ = writer.Write(line)
+			}
+		})
+	}
+}
+
+// FuzzWrite checks that splitting the input across writes doesn't change the output, and that every write
+// reports the length of its input.
+func FuzzWrite(f *testing.F) {
+	for _, test := range stripTests {
+		f.Add([]byte(test.input), uint8(1))
+		f.Add([]byte(test.input), uint8(3))
+	}
+
+	f.Fuzz(func(t *testing.T, input []byte, chunk uint8) {
+		var whole bytes.Buffer
+		n, err := (&StripColorWriter{W: &whole}).Write(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(input) {
+			t.Fatalf("want n = %d, got %d", len(input), n)
+		}
+
+		size := int(chunk)%16 + 1
+		var split bytes.Buffer
+		writer := &StripColorWriter{W: &split}
+		for start := 0; start < len(input); start += size {
+			part := input[start:min(start+size, len(input))]
+			n, err := writer.Write(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(part) {
+				t.Fatalf("want n = %d, got %d", len(part), n)
+			}
+		}
+
+		if !bytes.Equal(whole.Bytes(), split.Bytes()) {
+			t.Errorf("split into writes of %d bytes: want %q, got %q", size, whole.Bytes(), split.Bytes())
+		}
+		if bytes.IndexByte(whole.Bytes(), esc) >= 0 {
+			t.Errorf("escape left in output %q", whole.Bytes())
+		}
+	})
+}
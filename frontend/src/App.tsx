@@ -26,6 +26,7 @@ import { ArtistAnalysisCard } from 'src/components/cards/ArtistAnalysisCard';
 import MiniWrappedCards from 'src/components/cards/wrapped/MiniWrappedCards';
 import { analyzeArtists, analyzeSongs } from 'src/utils/analysis';
 import ArtistWrapped from 'src/components/cards/wrapped/ArtistWrapped';
+import DiscoverStatusCard from 'src/components/cards/DiscoverStatusCard';
 
 const getFilterFromDates = (fromDate: Moment | null, toDate: Moment | null): (pb: PlaybackData) => boolean  => {
     if (fromDate && toDate) {
@@ -211,6 +212,9 @@ const App = () => {
                         <Grid2 size={4}>
                             <FeatureLogCard />
                         </Grid2>
+                        <Grid2 size={4}>
+                            <DiscoverStatusCard />
+                        </Grid2>
                     </Grid2>
                 </>
             )}
@@ -0,0 +1,69 @@
+import React from 'react';
+import { Alert, Card, CardContent, CardHeader, Skeleton, Stack, Typography } from '@mui/material';
+import { useDiscoverApiHealthStatus } from 'src/discover/api/health';
+import { useMyStats } from 'src/discover/api/user';
+import { HealthStatusType } from 'src/discover/api/type';
+
+type DiscoverStatusCardProps = {};
+
+const severityOf = (status: HealthStatusType): 'success' | 'warning' | 'error' | 'info' => {
+    switch (status) {
+        case 'up':
+            return 'success';
+        case 'degraded':
+            return 'warning';
+        case 'down':
+            return 'error';
+        default:
+            return 'info';
+    }
+};
+
+/**
+ * A Card to display the health of the discover api, broken down per component, and the discovery progress of
+ * the current user's tracks.
+ */
+const DiscoverStatusCard: React.FC<DiscoverStatusCardProps> = () => {
+    const { data: health, isLoading: healthLoading, isError: healthError } = useDiscoverApiHealthStatus(true);
+    const { data: stats, isError: statsError } = useMyStats(!!health && health.status !== 'down');
+
+    return (
+        <Card>
+            <CardHeader title={'Discovery'}/>
+            <CardContent>
+                {healthLoading && (
+                    <Stack>
+                        <Skeleton variant={'text'}/>
+                        <Skeleton variant={'text'}/>
+                        <Skeleton variant={'text'}/>
+                    </Stack>
+                )}
+                {healthError && (
+                    <Alert severity={'error'}>The discover api is not reachable</Alert>
+                )}
+                {health && (
+                    <Stack spacing={2}>
+                        <Alert severity={severityOf(health.status)}>Discover api is {health.status}</Alert>
+                        {Object.entries(health.components).map(([name, component]) => (
+                            <Typography key={name}>
+                                {name}: {component.status}{component.message ? ` (${component.message})` : ''}
+                            </Typography>
+                        ))}
+                        {stats && (
+                            <>
+                                <Typography>Imported tracks: {stats.tracksCount}</Typography>
+                                <Typography>Discovered tracks: {stats.discoveredTracksCount}</Typography>
+                                <Typography>Remaining tracks: {stats.remainingTracksCount}</Typography>
+                            </>
+                        )}
+                        {statsError && (
+                            <Typography>Your discovery stats are not available</Typography>
+                        )}
+                    </Stack>
+                )}
+            </CardContent>
+        </Card>
+    );
+};
+
+export default DiscoverStatusCard;
@@ -1,13 +1,19 @@
 import { useQuery, UseQueryResult } from '@tanstack/react-query';
-import { discoverClient } from 'src/discover/client';
+import { discoverApiBaseUrl, discoverClient } from 'src/discover/client';
+import { HealthReportType } from 'src/discover/api/type';
 
-const getHealthStatus = async (): Promise<boolean> => {
-    const resp = await discoverClient.get('/health', { timeout: 1000 });
+const getHealthStatus = async (): Promise<HealthReportType> => {
+    const resp = await discoverClient.get<HealthReportType>('/health/ready', {
+        baseURL: discoverApiBaseUrl,
+        timeout: 1000,
+        // a 503 still carries the component breakdown explaining why discovery isn't progressing
+        validateStatus: (status) => status === 200 || status === 503,
+    });
 
-    return resp.status >= 200 && resp.status < 300;
+    return resp.data;
 };
 
-export const useDiscoverApiHealthStatus = (enabled: boolean): UseQueryResult<boolean> => {
+export const useDiscoverApiHealthStatus = (enabled: boolean): UseQueryResult<HealthReportType> => {
     return useQuery({
         queryFn: getHealthStatus,
         queryKey: ['discoverApiHealth'],
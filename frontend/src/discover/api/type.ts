@@ -11,3 +11,24 @@ export type DiscoverStatusResponseType = {
     remainingArtistsCount: number;
     alreadyDiscoveredCount: number;
 }
+
+export type UserStatsResponseType = {
+    importsCount: number;
+    tracksCount: number;
+    discoveredTracksCount: number;
+    remainingTracksCount: number;
+}
+
+export type HealthStatusType = 'up' | 'degraded' | 'down' | 'disabled';
+
+export type HealthComponentType = {
+    status: HealthStatusType;
+    message?: string;
+    details?: Record<string, unknown>;
+}
+
+export type HealthReportType = {
+    status: HealthStatusType;
+    checkedAt: string;
+    components: Record<string, HealthComponentType>;
+}
@@ -0,0 +1,18 @@
+import { useQuery, UseQueryResult } from '@tanstack/react-query';
+import { discoverClient } from 'src/discover/client';
+import { UserStatsResponseType } from 'src/discover/api/type';
+
+const getMyStats = async (): Promise<UserStatsResponseType> => {
+    const response = await discoverClient.get<UserStatsResponseType>('/me/stats');
+
+    return response.data;
+};
+
+export const useMyStats = (enabled: boolean): UseQueryResult<UserStatsResponseType> => {
+    return useQuery({
+        queryKey: ['myStats'],
+        queryFn: getMyStats,
+        refetchInterval: 5_000,
+        enabled,
+    });
+};
@@ -1,9 +1,16 @@
 import axios from 'axios';
 
+export const discoverApiBaseUrl = 'http://localhost:3040/';
+
+// The backend only reads X-User in dev mode without authentication, so it is only sent when
+// VITE_DISCOVER_USER is set for local development.
+const devUser = import.meta.env.VITE_DISCOVER_USER;
+
 export const discoverClient = axios.create({
-    baseURL: 'http://localhost:3040/',
+    baseURL: `${discoverApiBaseUrl}api/v1/`,
     headers: {
         'Content-Type': 'application/json',
+        ...(devUser ? { 'X-User': devUser } : {}),
     },
     timeout: 10000, // 10 seconds timeout
 });
@@ -1 +1,6 @@
 /// <reference types="vite/client" />
+
+interface ImportMetaEnv {
+    // user sent as X-User to a discover backend running in dev mode, see server.dev_mode of its config
+    readonly VITE_DISCOVER_USER?: string;
+}